@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"spiderman/crawl"
+)
+
+const (
+	// exit codes of the check mode, so CI can tell broken links apart from a failed check
+	exitBrokenLinks = 1
+	exitCheckFailed = 2
+)
+
+// runCheck crawls the site as usual while checking its external links, then writes the report of the broken ones.
+// it returns the exit code.
+func runCheck(ctx context.Context, input string, checkWorkers int, format string, opts []crawl.Option) int {
+	if format != formatText && format != formatJSONL {
+		fmt.Printf("check reports are written as %s or %s, not %q\n", formatText, formatJSONL, format)
+		return exitCheckFailed
+	}
+	checker := crawl.NewLinkChecker(ctx, checkWorkers)
+	err := crawl.NewCrawler(input, checker, opts...).CrawlContext(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "[Error]: %v\n", err)
+		return exitCheckFailed
+	}
+	report := checker.Report()
+	if format == formatJSONL {
+		err = writeJSONLReport(os.Stdout, report)
+	} else {
+		err = writeTextReport(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Error]: failed to write report: %v\n", err)
+		return exitCheckFailed
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Check was interrupted, the report is partial")
+		return exitCheckFailed
+	}
+	if len(report) > 0 {
+		return exitBrokenLinks
+	}
+	return 0
+}
+
+// writeTextReport lists the broken links by target, each followed by the pages linking to it.
+func writeTextReport(w io.Writer, report []crawl.BrokenLink) error {
+	external := 0
+	for _, broken := range report {
+		if broken.External {
+			external++
+		}
+	}
+	if _, err := fmt.Fprintf(w, "Broken links: %d (%d internal, %d external)\n", len(report), len(report)-external, external); err != nil {
+		return err
+	}
+	for _, broken := range report {
+		cause := string(broken.ErrType)
+		if broken.StatusCode != 0 {
+			cause = fmt.Sprintf("%d %s", broken.StatusCode, broken.ErrType)
+		} else if broken.Error != "" {
+			cause += ": " + broken.Error
+		}
+		if _, err := fmt.Fprintf(w, "\n%s [%s]\n", broken.URL, cause); err != nil {
+			return err
+		}
+		for _, referrer := range broken.Referrers {
+			line := " - linked from " + referrer.URL
+			if referrer.AnchorText != "" {
+				line += fmt.Sprintf(" as %q", referrer.AnchorText)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeJSONLReport writes a JSON object per broken link.
+func writeJSONLReport(w io.Writer, report []crawl.BrokenLink) error {
+	encoder := json.NewEncoder(w)
+	for _, broken := range report {
+		if err := encoder.Encode(broken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
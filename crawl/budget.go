@@ -0,0 +1,119 @@
+package crawl
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Budget bounds how much a single crawl can do, zero values mean no limit.
+// once a budget is hit no more pages are handed out, the pages being fetched are still completed and published.
+type Budget struct {
+	// MaxPages is the amount of pages fetched, failed pages included
+	MaxPages int
+	// MaxPagesPerHost is MaxPages for a single host, the other hosts keep being crawled once a host hits it
+	MaxPagesPerHost int
+	// MaxBytes is the amount of body bytes downloaded
+	MaxBytes int64
+	// MaxDuration is how long the crawl can run for
+	MaxDuration time.Duration
+}
+
+// budgetTracker keeps track of what a crawl used of its Budget, it's safe for concurrent usage.
+type budgetTracker struct {
+	budget Budget
+
+	mu           sync.Mutex
+	pages        int
+	pagesPerHost map[string]int
+	cappedHosts  []string
+	bytes        int64
+	stopReason   string
+	// exhausted is closed once a budget ending the crawl is hit
+	exhausted chan struct{}
+	timer     *time.Timer
+}
+
+func newBudgetTracker(budget Budget) *budgetTracker {
+	b := &budgetTracker{
+		budget:       budget,
+		pagesPerHost: make(map[string]int),
+		exhausted:    make(chan struct{}),
+	}
+	if budget.MaxDuration > 0 {
+		b.timer = time.AfterFunc(budget.MaxDuration, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.exhaust(fmt.Sprintf("max duration of %s", budget.MaxDuration))
+		})
+	}
+	return b
+}
+
+// take reserves a page for the url, returning false when the budget doesn't allow fetching it.
+func (b *budgetTracker) take(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopReason != "" {
+		return false
+	}
+	if b.budget.MaxPages > 0 && b.pages >= b.budget.MaxPages {
+		b.exhaust(fmt.Sprintf("max pages of %d", b.budget.MaxPages))
+		return false
+	}
+	host := hostOf(url)
+	if b.budget.MaxPagesPerHost > 0 && b.pagesPerHost[host] >= b.budget.MaxPagesPerHost {
+		if b.pagesPerHost[host] == b.budget.MaxPagesPerHost {
+			b.cappedHosts = append(b.cappedHosts, host)
+			// bumped past the max so the host is only reported once
+			b.pagesPerHost[host]++
+		}
+		return false
+	}
+	b.pages++
+	b.pagesPerHost[host]++
+	return true
+}
+
+// addBytes accounts for a downloaded body.
+func (b *budgetTracker) addBytes(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytes += n
+	if b.budget.MaxBytes > 0 && b.bytes >= b.budget.MaxBytes {
+		b.exhaust(fmt.Sprintf("max bytes of %d", b.budget.MaxBytes))
+	}
+}
+
+// exhaust ends the crawl for the reason, only the first reason is kept. b.mu must be held.
+func (b *budgetTracker) exhaust(reason string) {
+	if b.stopReason != "" {
+		return
+	}
+	b.stopReason = reason
+	close(b.exhausted)
+}
+
+// Exhausted is closed once a budget ending the crawl is hit.
+func (b *budgetTracker) Exhausted() <-chan struct{} {
+	return b.exhausted
+}
+
+func (b *budgetTracker) isExhausted() bool {
+	select {
+	case <-b.exhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop releases the wall-clock timer, returning the reason the crawl was stopped for and the hosts which were capped.
+func (b *budgetTracker) stop() (string, []string) {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopReason, append([]string(nil), b.cappedHosts...)
+}
@@ -0,0 +1,267 @@
+package crawl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spiderman/publish"
+)
+
+// Checkpoint configures where the progress of the crawl is saved, so a crawl can be resumed after a crash.
+// what was done after the last save is done again on resume. the pending and seen urls are kept in memory
+// and written whole at every save, whatever the Frontier and visited.Set of the crawl.
+type Checkpoint struct {
+	// Path of the checkpoint file, checkpointing is disabled when empty
+	Path string
+	// Interval between two saves, the progress is saved once more when the crawl ends
+	Interval time.Duration
+	// Resume picks up from the checkpoint at Path, a missing checkpoint starts the crawl from scratch
+	Resume bool
+}
+
+// checkpointFile is what gets written to Checkpoint.Path.
+type checkpointFile struct {
+	Seeds []string `json:"seeds"`
+	// Pending are the tasks which were queued but not processed yet, in the order they were queued
+	Pending []Task `json:"pending"`
+	// Seen are all the urls which were ever queued or landed on, pending ones included
+	Seen      []string        `json:"seen"`
+	Publisher json.RawMessage `json:"publisher,omitempty"`
+	SavedAt   time.Time       `json:"saved_at"`
+}
+
+// journal keeps track of the progress of the crawl and saves it to the checkpoint.
+// a nil journal is valid and doesn't keep track of anything, which is what's used when checkpointing is disabled.
+type journal struct {
+	config    Checkpoint
+	seeds     []string
+	publisher publish.Publisher
+
+	mu      sync.Mutex
+	seq     int
+	pending map[string]pendingTask
+	seen    map[string]bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type pendingTask struct {
+	seq  int
+	task Task
+}
+
+// progress is what processing a task changed, it's committed to the journal at once.
+type progress struct {
+	// finished is the url of the task which was processed
+	finished string
+	// seen are other urls which mustn't be crawled anymore e.g. the page the task redirected to
+	seen     []string
+	children []Task
+}
+
+// openJournal starts keeping track of the crawl of the seeds, resuming from the checkpoint when configured to.
+// the publisher gets its progress restored when it's publish.Resumable.
+func openJournal(config Checkpoint, seeds []Task, publisher publish.Publisher) (*journal, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+	j := &journal{
+		config:    config,
+		seeds:     make([]string, 0, len(seeds)),
+		publisher: publisher,
+		pending:   make(map[string]pendingTask),
+		seen:      make(map[string]bool),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	for _, seed := range seeds {
+		j.seeds = append(j.seeds, seed.URL)
+	}
+	saved, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		for _, seed := range seeds {
+			j.add(seed)
+		}
+		return j, nil
+	}
+	for _, url := range saved.Seen {
+		j.seen[url] = true
+	}
+	for _, task := range saved.Pending {
+		j.seq++
+		j.pending[task.URL] = pendingTask{seq: j.seq, task: task}
+	}
+	if resumable, ok := publisher.(publish.Resumable); ok && len(saved.Publisher) > 0 {
+		if err := resumable.Restore(saved.Publisher); err != nil {
+			return nil, fmt.Errorf("failed to restore publisher from checkpoint %s: %w", j.config.Path, err)
+		}
+	}
+	return j, nil
+}
+
+// load reads the checkpoint when resuming, nil is returned when there's nothing to resume from.
+func (j *journal) load() (*checkpointFile, error) {
+	if !j.config.Resume {
+		return nil, nil
+	}
+	content, err := os.ReadFile(j.config.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	saved := &checkpointFile{}
+	if err := json.Unmarshal(content, saved); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", j.config.Path, err)
+	}
+	if !slices.Equal(saved.Seeds, j.seeds) {
+		return nil, fmt.Errorf("checkpoint %s is for %s, not %s",
+			j.config.Path, strings.Join(saved.Seeds, ", "), strings.Join(j.seeds, ", "))
+	}
+	return saved, nil
+}
+
+// resumeState returns the tasks to start the crawl with and the urls which were already dealt with.
+func (j *journal) resumeState(seeds []Task) ([]Task, []string) {
+	if j == nil {
+		return seeds, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	visited := make([]string, 0, len(j.seen))
+	for url := range j.seen {
+		if _, isPending := j.pending[url]; !isPending {
+			visited = append(visited, url)
+		}
+	}
+	return j.pendingTasks(), visited
+}
+
+// pendingTasks returns the pending tasks in the order they were queued. j.mu must be held.
+func (j *journal) pendingTasks() []Task {
+	pending := make([]pendingTask, 0, len(j.pending))
+	for _, p := range j.pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(a, b int) bool { return pending[a].seq < pending[b].seq })
+	tasks := make([]Task, 0, len(pending))
+	for _, p := range pending {
+		tasks = append(tasks, p.task)
+	}
+	return tasks
+}
+
+// add marks the task as pending unless its url was seen before. j.mu must be held.
+func (j *journal) add(task Task) {
+	if j.seen[task.URL] {
+		return
+	}
+	j.seen[task.URL] = true
+	j.seq++
+	j.pending[task.URL] = pendingTask{seq: j.seq, task: task}
+}
+
+// commit records the progress, publishing is done by apply along the way so what's published and
+// the checkpoint always agree on which pages are done.
+func (j *journal) commit(p progress, apply func()) {
+	if j == nil {
+		if apply != nil {
+			apply()
+		}
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if apply != nil {
+		apply()
+	}
+	for _, url := range p.seen {
+		j.seen[url] = true
+	}
+	for _, child := range p.children {
+		j.add(child)
+	}
+	delete(j.pending, p.finished)
+}
+
+// start saves the checkpoint every Interval until close is called.
+func (j *journal) start() {
+	if j == nil {
+		return
+	}
+	go func() {
+		defer close(j.stopped)
+		if j.config.Interval <= 0 {
+			<-j.stop
+			return
+		}
+		ticker := time.NewTicker(j.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.save(); err != nil {
+					log.Printf("[Error] failed to save checkpoint: %s\n", err)
+				}
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the periodic saves and saves the checkpoint one last time.
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	close(j.stop)
+	<-j.stopped
+	return j.save()
+}
+
+// save writes the checkpoint to a temporary file first, so a crash while saving doesn't lose the previous one.
+func (j *journal) save() error {
+	j.mu.Lock()
+	saved := checkpointFile{
+		Seeds:   j.seeds,
+		Pending: j.pendingTasks(),
+		Seen:    make([]string, 0, len(j.seen)),
+		SavedAt: time.Now(),
+	}
+	for url := range j.seen {
+		saved.Seen = append(saved.Seen, url)
+	}
+	var publisherErr error
+	if resumable, ok := j.publisher.(publish.Resumable); ok {
+		saved.Publisher, publisherErr = resumable.Progress()
+	}
+	j.mu.Unlock()
+	if publisherErr != nil {
+		return fmt.Errorf("failed to save publisher progress: %w", publisherErr)
+	}
+
+	sort.Strings(saved.Seen)
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	tmp := j.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.config.Path)
+}
@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"spiderman/publish"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newChainSite serves pages "/", "/1" ... "/<pages-1>" each linking to the next one.
+func newChainSite(t *testing.T, pages int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 0
+		if r.URL.Path != "/" {
+			var err error
+			n, err = strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		if n+1 < pages {
+			_, _ = fmt.Fprintf(w, `<a href="/%d">next</a>`, n+1)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCrawler_ResumesFromCheckpoint(t *testing.T) {
+	crawls := map[string]func(c *Crawler) error{
+		"sequential": func(c *Crawler) error { return c.Crawl() },
+		"parallel":   func(c *Crawler) error { return c.CrawlParallel(2) },
+	}
+	for mode, crawl := range crawls {
+		t.Run(mode, func(t *testing.T) {
+			server := newChainSite(t, 6)
+			checkpoint := Checkpoint{Path: filepath.Join(t.TempDir(), "checkpoint.json"), Interval: time.Hour, Resume: true}
+			politeness := Politeness{MaxPerHost: 1}
+
+			first := publish.NewTestPublisher()
+			err := crawl(NewCrawler(server.URL, first, WithCheckpoint(checkpoint), WithPoliteness(politeness), WithBudget(Budget{MaxPages: 3})))
+			assert.NoError(t, err)
+
+			second := publish.NewTestPublisher()
+			err = crawl(NewCrawler(server.URL, second, WithCheckpoint(checkpoint), WithPoliteness(politeness)))
+			assert.NoError(t, err)
+
+			assert.Len(t, first.Meta, 3)
+			assert.Len(t, second.Meta, 3)
+			for url := range second.Meta {
+				assert.NotContains(t, first.Meta, url, "published twice")
+			}
+			assert.Equal(t, publish.Meta{Depth: 3, Parent: server.URL + "/2", AnchorText: "next"}, howFound(second.Meta)[server.URL+"/3"])
+
+			// the crawl is over, resuming it again has nothing left to do
+			third := publish.NewTestPublisher()
+			err = crawl(NewCrawler(server.URL, third, WithCheckpoint(checkpoint), WithPoliteness(politeness)))
+			assert.NoError(t, err)
+			assert.Empty(t, third.Meta)
+		})
+	}
+}
+
+func TestCrawler_CheckpointOfAnotherSeed(t *testing.T) {
+	server := newChainSite(t, 2)
+	checkpoint := Checkpoint{Path: filepath.Join(t.TempDir(), "checkpoint.json"), Resume: true}
+
+	err := NewCrawler(server.URL, publish.NewTestPublisher(), WithCheckpoint(checkpoint)).CrawlParallel(2)
+	assert.NoError(t, err)
+
+	err = NewCrawler(server.URL+"/1", publish.NewTestPublisher(), WithCheckpoint(checkpoint)).CrawlParallel(2)
+	assert.ErrorContains(t, err, "is for "+server.URL+"/")
+}
+
+func TestCrawler_CheckpointOfCappedHost(t *testing.T) {
+	crawls := map[string]func(c *Crawler) error{
+		"sequential": func(c *Crawler) error { return c.Crawl() },
+		"parallel":   func(c *Crawler) error { return c.CrawlParallel(2) },
+	}
+	for mode, crawl := range crawls {
+		t.Run(mode, func(t *testing.T) {
+			server := newChainSite(t, 3)
+			checkpoint := Checkpoint{Path: filepath.Join(t.TempDir(), "checkpoint.json"), Resume: true}
+
+			err := crawl(NewCrawler(server.URL, publish.NewTestPublisher(), WithCheckpoint(checkpoint), WithBudget(Budget{MaxPagesPerHost: 1})))
+			assert.NoError(t, err)
+
+			// the page of the capped host is done with rather than left pending
+			resumed := publish.NewTestPublisher()
+			err = crawl(NewCrawler(server.URL, resumed, WithCheckpoint(checkpoint)))
+			assert.NoError(t, err)
+			assert.Empty(t, resumed.Meta)
+		})
+	}
+}
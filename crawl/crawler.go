@@ -1,159 +1,811 @@
 package crawl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"spiderman/crawl/filters"
 	"strings"
 	"sync"
+	"time"
 
+	"spiderman/crawl/http"
 	"spiderman/crawl/links"
+	"spiderman/crawl/robots"
+	"spiderman/crawl/urlnorm"
+	"spiderman/crawl/visited"
 	"spiderman/publish"
 )
 
 type Crawler struct {
+	// fetcher is what the pages and robots.txt are fetched with
+	fetcher   links.Fetcher
+	userAgent string
 	parser    *links.Parser
-	publisher publish.Publisher
-	filters   []filters.Filter
-	baseUrl   string
+	// extractors replace the default ones of the parser when set, extraExtractors are added to them
+	extractors      []links.LinkExtractor
+	extraExtractors []links.LinkExtractor
+	publisher       publish.Publisher
+	filters         []filters.Filter
+	// filterChain replaces the default filters when set, extraFilters are added to them
+	filterChain  []filters.Filter
+	extraFilters []filters.Filter
+	baseUrl      string
+	// seeds are where the crawl starts, baseUrl first
+	seeds      []Task
+	extraSeeds []string
+	// rules include or exclude urls on top of the filters, nil when there are none
+	rules *filters.Rules
+	// internal tells whether a link stays within the scope of the crawl, the one of scopeMode by default
+	internal   filters.Filter
+	scopeMode  filters.ScopeMode
+	robots     *robots.Checker
+	politeness Politeness
+	retry      http.RetryPolicy
+	normalizer urlnorm.Normalizer
+	// maxDepth is the deepest a page can be from the seed to be crawled, negative for no limit
+	maxDepth   int
+	budget     Budget
+	checkpoint Checkpoint
+	// newFrontier creates where the tasks wait to be crawled, a new one for every crawl
+	newFrontier func() (Frontier, error)
+	// newVisitedSet creates the sets deduplicating the urls, new ones for every crawl
+	newVisitedSet func() visited.Set
+	// workers is how many pages CrawlContext fetches at once
+	workers int
+	hooks   Hooks
+	// linkChecker makes its checks like the crawler's requests, the publisher when it's a *LinkChecker by default
+	linkChecker *LinkChecker
 }
 
-func NewCrawler(baseUrl string, publisher publish.Publisher) *Crawler {
-	return &Crawler{
-		parser:    links.NewParser(),
-		publisher: publisher,
-		filters: []filters.Filter{
+func NewCrawler(baseUrl string, publisher publish.Publisher, opts ...Option) *Crawler {
+	// taking default as http
+	if !strings.Contains(baseUrl, "://") {
+		baseUrl = "http://" + baseUrl
+	}
+	defaultFetcher := http.NewFetcher()
+	c := &Crawler{
+		fetcher:    defaultFetcher,
+		publisher:  publisher,
+		baseUrl:    baseUrl,
+		scopeMode:  filters.ScopeHostWWW,
+		politeness: DefaultPoliteness(),
+		retry:      http.DefaultRetryPolicy(),
+		normalizer: urlnorm.DefaultNormalizer(),
+		maxDepth:   -1,
+		newFrontier: func() (Frontier, error) {
+			return NewMemoryFrontier(), nil
+		},
+		newVisitedSet: func() visited.Set {
+			return visited.NewExactSet()
+		},
+		workers: 1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.seeds = c.normalizedSeeds()
+	if c.internal == nil {
+		c.internal = c.seedsScope()
+	}
+	robotsAgent := robots.DefaultUserAgent
+	if c.userAgent != "" {
+		// a fetcher which was given is left as it was set up
+		if c.fetcher == links.Fetcher(defaultFetcher) {
+			defaultFetcher.UserAgent = c.userAgent
+		}
+		robotsAgent = robots.ProductToken(c.userAgent)
+	}
+	extractors := c.extractors
+	if extractors == nil {
+		extractors = links.DefaultExtractors()
+	}
+	extractors = append(append([]links.LinkExtractor(nil), extractors...), c.extraExtractors...)
+	c.parser = links.NewParser(links.WithFetcher(c.fetcher), links.WithExtractors(extractors...))
+	c.robots = robots.NewChecker(c.robotsFetcher(), robotsAgent)
+	if checker, ok := publisher.(*LinkChecker); ok && c.linkChecker == nil {
+		c.linkChecker = checker
+	}
+	if c.linkChecker != nil {
+		c.linkChecker.setUp(c.fetcher, c.retry, c.politeness)
+	}
+	if c.filterChain != nil {
+		c.filters = append(append([]filters.Filter(nil), c.filterChain...), c.extraFilters...)
+	} else {
+		c.filters = append([]filters.Filter{
 			&filters.NotEmpty{},
-			filters.NewInternalLink(baseUrl),
+			c.internal,
 			&filters.NotFragment{},
 			&filters.NotMailLink{},
 			&filters.NotTelephone{},
 			&filters.NotFile{},
-		},
-		baseUrl: baseUrl,
+		}, c.extraFilters...)
+		// kept last since it might need to fetch robots.txt for the host
+		c.filters = append(c.filters, robots.NewFilter(baseUrl, c.robots))
+	}
+	c.baseUrl = c.seeds[0].URL
+	return c
+}
+
+// normalizedSeeds returns the seed tasks, without duplicates.
+func (m *Crawler) normalizedSeeds() []Task {
+	seeds := make([]Task, 0, 1+len(m.extraSeeds))
+	added := make(map[string]bool)
+	for _, seed := range append([]string{m.baseUrl}, m.extraSeeds...) {
+		if !strings.Contains(seed, "://") {
+			seed = "http://" + seed
+		}
+		if normalized, err := m.normalizer.Normalize(seed); err == nil {
+			seed = normalized
+		}
+		if !added[seed] {
+			added[seed] = true
+			seeds = append(seeds, Task{URL: seed, Seed: seed})
+		}
+	}
+	return seeds
+}
+
+// seedsScope is the default scope, the hosts of the seeds or further according to the scope mode.
+func (m *Crawler) seedsScope() filters.Filter {
+	urls := make([]string, 0, len(m.seeds))
+	for _, seed := range m.seeds {
+		urls = append(urls, seed.URL)
 	}
+	scope, err := filters.ScopeOf(m.scopeMode, urls...)
+	if err != nil {
+		log.Printf("[Error] falling back to the host of %s as the scope: %s\n", m.baseUrl, err)
+		return filters.NewInternalLink(m.baseUrl)
+	}
+	return scope
+}
+
+// robotsFetcher fetches robots.txt with the fetcher of the pages,
+// retrying according to the crawler's policy unless the fetcher retries on its own.
+func (m *Crawler) robotsFetcher() robots.Fetcher {
+	if fetcher, ok := m.fetcher.(robots.Fetcher); ok {
+		return fetcher
+	}
+	return retryingFetcher{fetcher: m.fetcher, retry: m.retry}
+}
+
+// retryingFetcher retries with the policy of the crawler, it's meant for one-off requests where blocking is fine.
+type retryingFetcher struct {
+	fetcher links.Fetcher
+	retry   http.RetryPolicy
+}
+
+func (f retryingFetcher) FetchWithRetryContext(ctx context.Context, url string) http.FetchResult {
+	return f.retry.Do(ctx, func(ctx context.Context) http.FetchResult {
+		return f.fetcher.FetchContext(ctx, url)
+	})
+}
+
+// crawlDelay returns the Crawl-delay of the url's host, robots.txt is fetched until the context is done.
+func (m *Crawler) crawlDelay(ctx context.Context) func(url string) time.Duration {
+	return func(url string) time.Duration {
+		return m.robots.CrawlDelayContext(ctx, url)
+	}
+}
+
+// fetchPage fetches the page, following only the redirects to urls which would be crawled
+// so nothing out of the scope, the rules or robots.txt gets requested.
+func (m *Crawler) fetchPage(ctx context.Context, url string) (*links.Page, error) {
+	checked := http.WithRedirectCheck(ctx, func(next string) bool {
+		if normalized, err := m.normalizer.Normalize(next); err == nil {
+			next = normalized
+		}
+		return m.isCrawlable(ctx, next)
+	})
+	return m.parser.FetchPage(checked, url)
+}
+
+// isCrawlable tells whether the normalized absolute url should be crawled, see Explain.
+func (m *Crawler) isCrawlable(ctx context.Context, link string) bool {
+	return m.Explain(ctx, link).Crawlable
 }
 
-func (m *Crawler) isCrawlable(link string) bool {
+// Decision is what the crawler makes of a link, see Explain.
+type Decision struct {
+	Crawlable bool
+	// Rule is the rule which included or excluded the link, nil when none did
+	Rule *filters.Rule
+	// Filter is the filter which rejected the link, nil when none did
+	Filter filters.Filter
+}
+
+// Explain tells whether the normalized absolute url should be crawled along with what decided it,
+// the rules are checked first since they're the cheapest to check, then the filters in order.
+// the requests the filters make, e.g. for robots.txt, are aborted once the context is done.
+func (m *Crawler) Explain(ctx context.Context, link string) Decision {
+	decision := Decision{Crawlable: true}
+	if m.rules != nil {
+		decision.Crawlable, decision.Rule = m.rules.Decide(link)
+		if !decision.Crawlable {
+			return decision
+		}
+	}
 	for _, filter := range m.filters {
-		if !filter.Match(link) {
-			return false
+		if !filters.MatchContext(ctx, filter, link) {
+			decision.Crawlable, decision.Filter = false, filter
+			return decision
 		}
 	}
-	return true
+	return decision
 }
 
-func (m *Crawler) buildAbsolutePath(link string) string {
-	internalLink := filters.SanitizeLink(link)
-	baseDomain := filters.SanitizeLink(m.baseUrl)
-	// taking default as http
-	protocol := "http://"
-	if strings.Contains(m.baseUrl, "://") && strings.HasPrefix(m.baseUrl, "https://") {
-		protocol = "https://"
+// resolveLinks turns the links of the page into normalized absolute urls,
+// which are used both to dedupe the queue and to publish.
+// links which can't be fetched over http(s) are left out.
+func (m *Crawler) resolveLinks(page *links.Page) []links.Link {
+	base := pageBase(page)
+	resolved := make([]links.Link, 0, len(page.Links))
+	for _, link := range page.Links {
+		absoluteLink, err := m.normalizer.Resolve(base, link.Href)
+		if err != nil {
+			continue
+		}
+		resolved = append(resolved, links.Link{Href: absoluteLink, Text: link.Text, Rel: link.Rel, Fragment: link.Fragment})
+	}
+	return resolved
+}
+
+// pageBase is what the relative links of the page are relative to.
+func pageBase(page *links.Page) string {
+	if page.BaseHref != "" {
+		if withBase, err := urlnorm.Join(page.URL, page.BaseHref); err == nil {
+			return withBase
+		}
+	}
+	return page.URL
+}
+
+// childTasks returns the tasks for the links of the page which should be crawled.
+func (m *Crawler) childTasks(ctx context.Context, parent Task, pageUrl string, pageLinks []links.Link) []Task {
+	depth := parent.Depth + 1
+	if m.maxDepth >= 0 && depth > m.maxDepth {
+		return nil
+	}
+	tasks := make([]Task, 0, len(pageLinks))
+	for _, link := range pageLinks {
+		if !m.isCrawlable(ctx, link.Href) {
+			continue
+		}
+		tasks = append(tasks, Task{URL: link.Href, Seed: parent.Seed, Depth: depth, Parent: pageUrl, AnchorText: link.Text})
+	}
+	return tasks
+}
+
+func hrefs(pageLinks []links.Link) []string {
+	result := make([]string, 0, len(pageLinks))
+	for _, link := range pageLinks {
+		result = append(result, link.Href)
+	}
+	return result
+}
+
+func toMeta(task Task, page *links.Page) publish.Meta {
+	return publish.Meta{
+		Seed:        task.Seed,
+		Depth:       task.Depth,
+		Parent:      task.Parent,
+		AnchorText:  task.AnchorText,
+		StatusCode:  page.StatusCode,
+		ContentType: page.ContentType,
+		Duration:    page.Duration,
+	}
+}
+
+// publishedMeta is the meta of a page which is published along with its links.
+func (m *Crawler) publishedMeta(task Task, page *links.Page, pageLinks []links.Link) publish.Meta {
+	meta := toMeta(task, page)
+	meta.LastModified = page.LastModified
+	meta.NoIndex = page.NoIndex
+	meta.Anchors = page.Anchors
+	if page.Canonical != "" {
+		if canonical, err := m.normalizer.Resolve(pageBase(page), page.Canonical); err == nil {
+			meta.Canonical = canonical
+		}
 	}
-	if strings.HasPrefix(internalLink, baseDomain) {
-		return protocol + internalLink
+	meta.Links = make([]publish.Link, 0, len(pageLinks))
+	for _, link := range pageLinks {
+		meta.Links = append(meta.Links, publish.Link{
+			URL:        link.Href,
+			AnchorText: link.Text,
+			Rel:        link.Rel,
+			Fragment:   link.Fragment,
+			Internal:   m.internal.Match(link.Href),
+		})
 	}
-	return protocol + baseDomain + "/" + internalLink
+	return meta
 }
 
 func (m *Crawler) Crawl() error {
-	_, err := m.parser.FetchLinks(m.baseUrl)
+	return m.CrawlContext(context.Background())
+}
+
+// CrawlContext crawls with the workers of WithWorkers, sequentially by default, until there's nothing left or the context is done.
+// On cancellation the stats of what was crawled so far are still published and the context's error is returned.
+func (m *Crawler) CrawlContext(ctx context.Context) error {
+	if m.workers > 1 {
+		return m.CrawlParallelContext(ctx, m.workers)
+	}
+	return m.crawlSequential(ctx)
+}
+
+// probeSeeds fails when none of the seeds can be accessed,
+// the ones which can't are still crawled so they're recorded as errors.
+func (m *Crawler) probeSeeds(ctx context.Context) error {
+	var errs []error
+	for _, seed := range m.seeds {
+		_, err := m.fetchPage(ctx, seed.URL)
+		if err == nil || errors.Is(err, http.ErrRedirectRejected) {
+			// a seed redirecting out of the crawl could still be accessed
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("failed to access initial URL %s: %w", seed.URL, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Crawler) crawlSequential(ctx context.Context) error {
+	if err := m.probeSeeds(ctx); err != nil {
+		return err
+	}
+
+	frontier, err := m.newFrontier()
 	if err != nil {
-		return fmt.Errorf("failed to access initial URL %s: %w", m.baseUrl, err)
+		return fmt.Errorf("failed to create frontier: %w", err)
 	}
+	journal, err := openJournal(m.checkpoint, m.seeds, m.publisher)
+	if err != nil {
+		_ = frontier.Close()
+		return err
+	}
+	journal.start()
+	tasks, visited := journal.resumeState(m.seeds)
 
-	queue := NewFifoQueue()
+	seen := m.newVisitedSet()
+	run := &sequentialRun{
+		ctx:     ctx,
+		queue:   NewFifoQueueWith(frontier, seen),
+		budget:  newBudgetTracker(m.budget),
+		journal: journal,
+	}
+	defer run.queue.Close()
+	for _, task := range tasks {
+		run.queue.Add(task)
+	}
+	for _, url := range visited {
+		run.queue.MarkSeen(url)
+	}
+	scheduler := NewHostScheduler(m.politeness, m.crawlDelay(ctx))
+	defer scheduler.Close()
 
-	queue.Add(m.baseUrl)
-	nextUrl := queue.Grab()
-	for ; nextUrl != ""; nextUrl = queue.Grab() {
-		m.crawlAndPublishLinks(nextUrl, queue)
+	next := run.queue.Grab()
+	for ; next.URL != "" && ctx.Err() == nil && !run.budget.isExhausted(); next = run.queue.Grab() {
+		if !m.hooks.beforeFetch(next) {
+			run.journal.commit(progress{finished: next.URL}, nil)
+			continue
+		}
+		if !run.budget.take(next.URL) {
+			// the host is over its budget, once the whole budget is exhausted the url is left pending
+			// along with the rest of the queue so a resumed crawl gets to it
+			if !run.budget.isExhausted() {
+				run.journal.commit(progress{finished: next.URL}, nil)
+			}
+			continue
+		}
+		scheduler.Submit(next)
+		for attempt := 1; ; attempt++ {
+			// waits until the host is free to be requested again
+			select {
+			case <-scheduler.Ready():
+			case <-ctx.Done():
+			case <-run.budget.Exhausted():
+			}
+			if ctx.Err() != nil || run.budget.isExhausted() {
+				break
+			}
+			retryIn, retry := m.crawlAndPublishLinks(next, attempt, run)
+			scheduler.Done(next)
+			if !retry {
+				break
+			}
+			scheduler.SubmitAfter(next, retryIn)
+		}
+	}
+	if err := journal.close(); err != nil {
+		log.Printf("[Error] failed to save checkpoint: %s\n", err)
 	}
-	_ = m.publisher.PublishStats()
-	return nil
+	_ = m.publisher.PublishStats(summaryOf(run.budget, namedSet{"seen", seen}))
+	return ctx.Err()
 }
 
-func (m *Crawler) crawlAndPublishLinks(nextUrl string, queue *FifoQueue) {
-	linksForPage, err := m.parser.FetchLinks(nextUrl)
+// sequentialRun holds the state of a single Crawl call.
+type sequentialRun struct {
+	ctx     context.Context
+	queue   *FifoQueue
+	budget  *budgetTracker
+	journal *journal
+}
+
+// crawlAndPublishLinks returns when to retry the page if the attempt failed and can be retried.
+func (m *Crawler) crawlAndPublishLinks(next Task, attempt int, run *sequentialRun) (time.Duration, bool) {
+	page, err := m.fetchPage(run.ctx, next.URL)
+	run.budget.addBytes(page.Size)
+	m.hooks.afterFetch(next, page, err)
 	if err != nil {
-		_ = m.publisher.RecordError(nextUrl, resolveErrType(err), err)
+		if run.ctx.Err() != nil {
+			// the crawl is being stopped, the page didn't fail on its own
+			return 0, false
+		}
+		if errors.Is(err, http.ErrRedirectRejected) {
+			// it redirects out of what's crawled, only its chain is published
+			run.journal.commit(progress{finished: next.URL}, func() { m.publishRedirects(page) })
+			return 0, false
+		}
+		if retryIn, retry := m.retry.Backoff(attempt, err); retry {
+			log.Printf("[Retry] attempt %d for %s failed, retrying in %s: %s\n", attempt, next.URL, retryIn, err)
+			return retryIn, true
+		}
+		run.journal.commit(progress{finished: next.URL}, func() {
+			m.publishRedirects(page)
+			_ = m.publisher.RecordError(next.URL, resolveErrType(err), err, toMeta(next, page))
+		})
 		log.Printf("[Error] failed to crawl page: %s\n", err)
-		return
+		return 0, false
 	}
-	err = m.publisher.Publish(nextUrl, linksForPage)
-	if err != nil {
-		log.Printf("[Error] failed to publish page: %s\n", err)
+	pageUrl := m.pageUrl(page)
+	// a fetcher which doesn't honour http.WithRedirectCheck might still have followed a redirect out of what's crawled
+	if pageUrl != next.URL && !m.isCrawlable(run.ctx, pageUrl) {
+		run.journal.commit(progress{finished: next.URL}, func() { m.publishRedirects(page) })
+		return 0, false
+	}
+	// the page redirected to is crawled only once, whichever url got there first
+	if pageUrl != next.URL && !run.queue.MarkSeen(pageUrl) {
+		run.journal.commit(progress{finished: next.URL}, func() { m.publishRedirects(page) })
+		return 0, false
 	}
-	for _, link := range linksForPage {
-		if m.isCrawlable(link) {
-			queue.Add(m.buildAbsolutePath(link))
+	linksForPage := m.resolveLinks(page)
+	children := m.childTasks(run.ctx, next, pageUrl, linksForPage)
+	run.journal.commit(progress{finished: next.URL, seen: []string{pageUrl}, children: children}, func() {
+		m.publishRedirects(page)
+		if err := m.publisher.Publish(pageUrl, hrefs(linksForPage), m.publishedMeta(next, page, linksForPage)); err != nil {
+			log.Printf("[Error] failed to publish page: %s\n", err)
 		}
+	})
+	for _, task := range children {
+		run.queue.Add(task)
 	}
+	return 0, false
 }
 
 // CrawlParallel starts the crawl with the specified number of workers.
+// urls go through a HostScheduler before reaching the workers so no host gets more than its fair share.
 func (c *Crawler) CrawlParallel(maxWorkers int) error {
-	bufferSize := maxWorkers * 500
-	queue := NewTaskQueue(c.baseUrl, bufferSize)
-	var wg sync.WaitGroup
-	wg.Add(1)
+	return c.CrawlParallelContext(context.Background(), maxWorkers)
+}
+
+// CrawlParallelContext is CrawlParallel which stops once the context is done or the budget is hit.
+// On cancellation no more urls are handed out, in-flight requests are aborted
+// and once the workers are done the stats of what was crawled so far are published.
+// the context's error is returned in that case.
+func (c *Crawler) CrawlParallelContext(ctx context.Context, maxWorkers int) error {
+	frontier, err := c.newFrontier()
+	if err != nil {
+		return fmt.Errorf("failed to create frontier: %w", err)
+	}
+	journal, err := openJournal(c.checkpoint, c.seeds, c.publisher)
+	if err != nil {
+		_ = frontier.Close()
+		return err
+	}
+	journal.start()
+	tasks, visited := journal.resumeState(c.seeds)
+
+	queuedSet, visitedSet := c.newVisitedSet(), c.newVisitedSet()
+	run := &parallelRun{
+		ctx:       ctx,
+		queue:     NewTaskQueueWith(frontier, queuedSet, visitedSet),
+		scheduler: NewHostScheduler(c.politeness, c.crawlDelay(ctx)),
+		retries:   newRetries(),
+		budget:    newBudgetTracker(c.budget),
+		journal:   journal,
+		inFlight:  newInFlight(),
+	}
+	for _, url := range visited {
+		run.queue.MarkSeen(url)
+	}
+	for _, task := range tasks {
+		if run.queue.Add(task) {
+			run.inFlight.add()
+		}
+	}
+	run.inFlight.done()
+
+	go func() {
+		for task := range run.queue.QueuedTasks() {
+			run.scheduler.Submit(task)
+		}
+	}()
 
 	// Start workers
+	var workers sync.WaitGroup
 	for i := 0; i < maxWorkers; i++ {
+		workers.Add(1)
 		go func(id int) {
-			for url := range queue.QueuedTasks() {
-				c.processURL(id, url, queue, &wg)
+			defer workers.Done()
+			for task := range run.scheduler.Ready() {
+				c.processURL(id, task, run)
+				run.scheduler.Done(task)
 			}
 		}(i)
 	}
 
-	// Wait for all URLs to be processed
-	wg.Wait()
-	queue.Close()
+	// Wait for all URLs to be processed, the crawl to be cancelled or the budget to be hit
+	select {
+	case <-run.inFlight.idle:
+	case <-ctx.Done():
+	case <-run.budget.Exhausted():
+	}
+	run.scheduler.Close()
+	// workers have to be done before closing the queue as they might still be adding to it
+	workers.Wait()
+	run.queue.Close()
 
-	return c.publisher.PublishStats()
+	if err := journal.close(); err != nil {
+		log.Printf("[Error] failed to save checkpoint: %s\n", err)
+	}
+	if err := c.publisher.PublishStats(summaryOf(run.budget, namedSet{"queued", queuedSet}, namedSet{"visited", visitedSet})); err != nil {
+		return err
+	}
+	return ctx.Err()
 }
 
-// processURL processes a single URL: publishing, fetching links, and enqueuing.
-func (c *Crawler) processURL(workerID int, url string, queue *TaskQueue, wg *sync.WaitGroup) {
-	defer wg.Done()
+// parallelRun holds the state shared by the workers of a single CrawlParallel call.
+type parallelRun struct {
+	ctx       context.Context
+	queue     *TaskQueue
+	scheduler *HostScheduler
+	retries   *retries
+	budget    *budgetTracker
+	journal   *journal
+	inFlight  *inFlight
+}
+
+// inFlight counts the tasks which are queued or being processed, idle is closed once they're all done.
+// unlike a sync.WaitGroup nothing is left waiting on it when the crawl stops before then.
+type inFlight struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
 
-	// If already visited, skip
-	if !queue.MarkVisited(url) {
+// newInFlight starts with a task in flight, so it isn't idle before the seeds were added,
+// which is done with once they were.
+func newInFlight() *inFlight {
+	return &inFlight{count: 1, idle: make(chan struct{})}
+}
+
+func (f *inFlight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+}
+
+func (f *inFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+	if f.count == 0 {
+		close(f.idle)
+	}
+}
+
+// processURL processes a single URL: publishing, fetching links, and enqueuing.
+func (c *Crawler) processURL(workerID int, task Task, run *parallelRun) {
+	url := task.URL
+	defer run.inFlight.done()
+	if run.ctx.Err() != nil || run.budget.isExhausted() {
 		return
 	}
 
-	linksForPage, err := c.parser.FetchLinks(url)
+	attempt := run.retries.take(url)
+	// If already visited, skip. retries are visited by definition and already accounted for in the budget
+	if attempt == 1 {
+		if !run.queue.MarkVisited(url) || !c.hooks.beforeFetch(task) {
+			run.journal.commit(progress{finished: url}, nil)
+			return
+		}
+		if !run.budget.take(url) {
+			// the host is over its budget, once the whole budget is exhausted the url is left pending
+			// along with the rest of the queue so a resumed crawl gets to it
+			if !run.budget.isExhausted() {
+				run.journal.commit(progress{finished: url}, nil)
+			}
+			return
+		}
+	}
+
+	page, err := c.fetchPage(run.ctx, url)
+	run.budget.addBytes(page.Size)
+	c.hooks.afterFetch(task, page, err)
 	if err != nil {
+		if run.ctx.Err() != nil {
+			// the crawl is being stopped, the page didn't fail on its own
+			return
+		}
+		if errors.Is(err, http.ErrRedirectRejected) {
+			// it redirects out of what's crawled, only its chain is published
+			run.journal.commit(progress{finished: url}, func() { c.publishRedirects(page) })
+			return
+		}
+		if retryIn, retry := c.retry.Backoff(attempt, err); retry {
+			log.Printf("[Worker %d] Attempt %d for %s failed, retrying in %s: %v", workerID, attempt, url, retryIn, err)
+			// the retry takes over this url's spot in the wait group
+			run.inFlight.add()
+			run.retries.schedule(url, attempt+1)
+			run.scheduler.SubmitAfter(task, retryIn)
+			return
+		}
 		log.Printf("[Worker %d] Error fetching %s: %v", workerID, url, err)
-		_ = c.publisher.RecordError(url, resolveErrType(err), err)
+		run.journal.commit(progress{finished: url}, func() {
+			c.publishRedirects(page)
+			_ = c.publisher.RecordError(url, resolveErrType(err), err, toMeta(task, page))
+		})
 		return
 	}
-	_ = c.publisher.Publish(url, linksForPage)
+	pageUrl := c.pageUrl(page)
+	// a fetcher which doesn't honour http.WithRedirectCheck might still have followed a redirect out of what's crawled
+	if pageUrl != url && !c.isCrawlable(run.ctx, pageUrl) {
+		run.journal.commit(progress{finished: url}, func() { c.publishRedirects(page) })
+		return
+	}
+	// the page redirected to is crawled only once, whichever url got there first
+	if pageUrl != url && !run.queue.MarkVisited(pageUrl) {
+		run.journal.commit(progress{finished: url}, func() { c.publishRedirects(page) })
+		return
+	}
+	linksForPage := c.resolveLinks(page)
+	children := c.childTasks(run.ctx, task, pageUrl, linksForPage)
+	run.journal.commit(progress{finished: url, seen: []string{pageUrl}, children: children}, func() {
+		c.publishRedirects(page)
+		_ = c.publisher.Publish(pageUrl, hrefs(linksForPage), c.publishedMeta(task, page, linksForPage))
+	})
 
-	for _, link := range linksForPage {
-		if !c.isCrawlable(link) {
-			continue
-		}
-		absoluteLink := c.buildAbsolutePath(link)
-		if queue.Add(absoluteLink) {
-			wg.Add(1)
+	for _, child := range children {
+		if run.queue.Add(child) {
+			run.inFlight.add()
 		}
 	}
 }
 
+// namedSet is a visited set along with what it's used for, for the stats.
+type namedSet struct {
+	name string
+	set  visited.Set
+}
+
+// summaryOf stops the budget, summarizing how the crawl ended.
+func summaryOf(budget *budgetTracker, sets ...namedSet) publish.Summary {
+	reason, cappedHosts := budget.stop()
+	summary := publish.Summary{StopReason: reason, CappedHosts: cappedHosts}
+	for _, named := range sets {
+		stats := named.set.Stats()
+		summary.VisitedSets = append(summary.VisitedSets, publish.VisitedSetStats{
+			Name:              named.name,
+			Kind:              stats.Kind,
+			Count:             stats.Count,
+			MemoryBytes:       stats.MemoryBytes,
+			FalsePositiveRate: stats.FalsePositiveRate,
+		})
+	}
+	return summary
+}
+
+// pageUrl is the normalized url where the page ended up after redirects.
+func (c *Crawler) pageUrl(page *links.Page) string {
+	normalized, err := c.normalizer.Normalize(page.URL)
+	if err != nil {
+		return page.URL
+	}
+	return normalized
+}
+
+// publishRedirects publishes the redirect chain which lead to the page, if there was any.
+func (c *Crawler) publishRedirects(page *links.Page) {
+	if len(page.Redirects) == 0 {
+		return
+	}
+	chain := make([]publish.Redirect, 0, len(page.Redirects)+1)
+	for _, hop := range page.Redirects {
+		chain = append(chain, publish.Redirect{URL: hop.URL, StatusCode: hop.StatusCode})
+	}
+	// on loops and too many redirects the last hop is where it ended up
+	if last := page.Redirects[len(page.Redirects)-1]; last.URL != page.URL {
+		chain = append(chain, publish.Redirect{URL: page.URL, StatusCode: page.StatusCode})
+	}
+	if err := c.publisher.PublishRedirects(chain); err != nil {
+		log.Printf("[Error] failed to publish redirects: %s\n", err)
+	}
+}
+
+// retries keeps track of the attempt of the urls waiting to be fetched again.
+type retries struct {
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func newRetries() *retries {
+	return &retries{attempts: make(map[string]int)}
+}
+
+func (r *retries) schedule(url string, attempt int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[url] = attempt
+}
+
+// take returns the attempt the url is on, forgetting about it.
+// urls which aren't being retried are on their first attempt.
+func (r *retries) take(url string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, exists := r.attempts[url]
+	if !exists {
+		return 1
+	}
+	delete(r.attempts, url)
+	return attempt
+}
+
+// resolveErrType classifies the error a page failed with from the typed errors of the fetcher.
 func resolveErrType(err error) publish.ErrType {
-	switch err.Error() {
-	case "failed with status 500":
-		return publish.ErrTypeInternal
-	case "failed with status 404":
+	var statusErr *http.StatusError
+	var timeoutErr *http.TimeoutError
+	var dnsErr *http.DNSError
+	var connectionErr *http.ConnectionError
+	var tlsErr *http.TLSError
+	var tooLargeErr *http.TooLargeError
+	var parseErr *http.ParseError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErrType(statusErr.StatusCode)
+	case errors.Is(err, http.ErrRedirectLoop) || errors.Is(err, http.ErrTooManyRedirects):
+		return publish.ErrTypeRedirect
+	case errors.As(err, &timeoutErr):
+		return publish.ErrTypeTimeout
+	case errors.As(err, &dnsErr):
+		return publish.ErrTypeDNS
+	case errors.As(err, &connectionErr):
+		return publish.ErrTypeConnection
+	case errors.As(err, &tlsErr):
+		return publish.ErrTypeTLS
+	case errors.As(err, &tooLargeErr):
+		return publish.ErrTypeTooLarge
+	case errors.As(err, &parseErr):
+		return publish.ErrTypeParse
+	}
+	// logged rather than printed, so it doesn't end up in the results
+	log.Printf("[Error] unclassified error: %s\n", err)
+	return publish.ErrTypeUnknown
+}
+
+// statusErrType classifies a status which can't be crawled.
+func statusErrType(code int) publish.ErrType {
+	switch {
+	case code == 404 || code == 410:
 		return publish.ErrTypeNotFound
-	case "failed with status 403":
+	case code == 401 || code == 403:
 		return publish.ErrTypeNoAccess
-	default:
-		fmt.Println("-------------------ERROR FOUND------------------------------")
-		fmt.Println(err.Error())
+	case code == 429:
+		return publish.ErrTypeRateLimited
+	case code >= 400 && code < 500:
+		return publish.ErrTypeClient
+	case code >= 500 && code < 600:
+		return publish.ErrTypeInternal
 	}
-	return publish.ErrTypeUnknown
+	return publish.ErrTypeStatus
 }
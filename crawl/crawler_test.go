@@ -1,12 +1,28 @@
 package crawl
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"spiderman/crawl/filters"
+	crawlhttp "spiderman/crawl/http"
+	"spiderman/crawl/links"
+	"spiderman/crawl/visited"
 	"spiderman/publish"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
 )
 
 func TestCrawler_Integration_SmallSite(t *testing.T) {
@@ -77,7 +93,8 @@ func TestCrawler_CrawlParallel_InvalidDomain(t *testing.T) {
 
 func TestCrawler_IsCrawlable(t *testing.T) {
 	publisher := publish.NewTestPublisher()
-	crawler := NewCrawler("https://example.com", publisher)
+	// without a robots.txt everything is allowed, so only the other filters are being tested
+	crawler := NewCrawler("https://example.com", publisher, WithFetcher(crawlhttp.NewFixtureFetcher(nil)))
 
 	tests := []struct {
 		name     string
@@ -128,69 +145,925 @@ func TestCrawler_IsCrawlable(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := crawler.isCrawlable(tt.link)
+			result := crawler.isCrawlable(context.Background(), tt.link)
 			assert.Equal(t, tt.expected, result, "Link: %s", tt.link)
 		})
 	}
 }
 
-func TestCrawler_BuildAbsolutePath(t *testing.T) {
+func TestCrawler_ResolveLinks(t *testing.T) {
 	tests := []struct {
 		name     string
-		baseUrl  string
-		link     string
-		expected string
+		page     links.Page
+		expected []string
 	}{
 		{
-			name:     "https base with relative link",
-			baseUrl:  "https://example.com",
-			link:     "/about",
-			expected: "https://example.com/about",
+			name:     "https page with relative link",
+			page:     links.Page{URL: "https://example.com", Links: []links.Link{{Href: "/about"}}},
+			expected: []string{"https://example.com/about"},
+		},
+		{
+			name:     "http page with relative link",
+			page:     links.Page{URL: "http://example.com", Links: []links.Link{{Href: "/contact"}}},
+			expected: []string{"http://example.com/contact"},
 		},
 		{
-			name:     "http base with relative link",
-			baseUrl:  "http://example.com",
-			link:     "/contact",
-			expected: "http://example.com/contact",
+			name:     "relative link without leading slash is relative to the page directory",
+			page:     links.Page{URL: "https://example.com/blog/post", Links: []links.Link{{Href: "about"}}},
+			expected: []string{"https://example.com/blog/about"},
 		},
 		{
-			name:     "base without protocol with relative link",
-			baseUrl:  "example.com",
-			link:     "/services",
-			expected: "http://example.com/services",
+			name:     "page with trailing slash",
+			page:     links.Page{URL: "https://example.com/", Links: []links.Link{{Href: "about"}}},
+			expected: []string{"https://example.com/about"},
 		},
 		{
-			name:     "absolute link already contains base domain",
-			baseUrl:  "https://example.com",
-			link:     "example.com/products",
-			expected: "https://example.com/products",
+			name:     "dot segments",
+			page:     links.Page{URL: "https://blog.example.com/posts/2023/", Links: []links.Link{{Href: "../2024/article"}}},
+			expected: []string{"https://blog.example.com/posts/2024/article"},
 		},
 		{
-			name:     "relative link without leading slash",
-			baseUrl:  "https://example.com",
-			link:     "about",
-			expected: "https://example.com/about",
+			name:     "query strings are kept",
+			page:     links.Page{URL: "https://example.com/search", Links: []links.Link{{Href: "?page=2"}}},
+			expected: []string{"https://example.com/search?page=2"},
 		},
 		{
-			name:     "base with trailing slash",
-			baseUrl:  "https://example.com/",
-			link:     "about",
-			expected: "https://example.com/about",
+			name:     "absolute link keeps its own scheme and port",
+			page:     links.Page{URL: "https://example.com", Links: []links.Link{{Href: "http://example.com:8080/page"}}},
+			expected: []string{"http://example.com:8080/page"},
 		},
 		{
-			name:     "complex relative path",
-			baseUrl:  "https://blog.example.com",
-			link:     "posts/2023/article",
-			expected: "https://blog.example.com/posts/2023/article",
+			name:     "base href",
+			page:     links.Page{URL: "https://example.com/a/b", BaseHref: "/docs/", Links: []links.Link{{Href: "intro"}}},
+			expected: []string{"https://example.com/docs/intro"},
+		},
+		{
+			name:     "links which aren't http are left out",
+			page:     links.Page{URL: "https://example.com", Links: []links.Link{{Href: "javascript:void(0)"}, {Href: "/ok"}}},
+			expected: []string{"https://example.com/ok"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			crawler := NewCrawler("https://example.com", publish.NewTestPublisher())
+			result := crawler.resolveLinks(&tt.page)
+			assert.Equal(t, tt.expected, hrefs(result))
+		})
+	}
+}
+
+func TestNewCrawler_NormalizesSeed(t *testing.T) {
+	assert.Equal(t, "http://example.com/", NewCrawler("example.com", publish.NewTestPublisher()).baseUrl)
+	assert.Equal(t, "https://example.com/a", NewCrawler("HTTPS://Example.com:443/a", publish.NewTestPublisher()).baseUrl)
+}
+
+func TestCrawler_Crawl_RespectsRobots(t *testing.T) {
+	var adminHits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /admin\n"))
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/about">About</a><a href="/admin">Admin</a>`))
+		case "/about":
+			_, _ = w.Write([]byte(`<a href="/admin/users">Users</a>`))
+		default:
+			adminHits.Add(1)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher).Crawl()
+	assert.NoError(t, err)
+	assert.Contains(t, publisher.Published, server.URL+"/about")
+	assert.Equal(t, int32(0), adminHits.Load())
+
+	err = NewCrawler(server.URL, publish.NewTestPublisher()).CrawlParallel(3)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), adminHits.Load())
+}
+
+func TestCrawler_CrawlParallel_RetriesFlakyPages(t *testing.T) {
+	var aboutRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/about">About</a>`))
+		case "/about":
+			if aboutRequests.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`<p>about</p>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	policy := crawlhttp.DefaultRetryPolicy()
+	policy.BaseBackoff = time.Millisecond
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher, WithRetryPolicy(policy)).CrawlParallel(2)
+	assert.NoError(t, err)
+	assert.Contains(t, publisher.Published, server.URL+"/about")
+	assert.Equal(t, int32(3), aboutRequests.Load())
+}
+
+func TestCrawler_Crawl_FollowsRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/old">Old</a><a href="/new">New</a>`))
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			_, _ = w.Write([]byte(`<p>new</p>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	expectedChain := []publish.Redirect{
+		{URL: server.URL + "/old", StatusCode: http.StatusMovedPermanently},
+		{URL: server.URL + "/new", StatusCode: http.StatusOK},
+	}
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher).Crawl()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]publish.Redirect{expectedChain}, publisher.Redirects)
+	assert.Equal(t, []string{server.URL + "/", server.URL + "/old", server.URL + "/new", server.URL + "/new"}, publisher.Published)
+
+	publisher = publish.NewTestPublisher()
+	err = NewCrawler(server.URL, publisher).CrawlParallel(1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]publish.Redirect{expectedChain}, publisher.Redirects)
+	assert.Equal(t, []string{server.URL + "/", server.URL + "/old", server.URL + "/new", server.URL + "/new"}, publisher.Published)
+}
+
+func TestCrawler_RedirectOffSite(t *testing.T) {
+	var offSiteRequests, secretRequests atomic.Int32
+	offSite := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offSiteRequests.Add(1)
+		_, _ = w.Write([]byte(`<a href="/elsewhere">Elsewhere</a>`))
+	}))
+	defer offSite.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/away">Away</a><a href="/go">Go</a>`))
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /secret"))
+		case "/away":
+			http.Redirect(w, r, offSite.URL+"/landing", http.StatusFound)
+		case "/go":
+			http.Redirect(w, r, "/secret", http.StatusFound)
+		case "/secret":
+			secretRequests.Add(1)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// the targets are never requested so their status isn't known
+	expectedChains := [][]publish.Redirect{
+		{{URL: server.URL + "/away", StatusCode: http.StatusFound}, {URL: offSite.URL + "/landing"}},
+		{{URL: server.URL + "/go", StatusCode: http.StatusFound}, {URL: server.URL + "/secret"}},
+	}
+	tests := []struct {
+		name  string
+		crawl func(c *Crawler) error
+	}{
+		{name: "sequential", crawl: func(c *Crawler) error { return c.Crawl() }},
+		{name: "parallel", crawl: func(c *Crawler) error { return c.CrawlParallel(2) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
 			publisher := publish.NewTestPublisher()
-			crawler := NewCrawler(tt.baseUrl, publisher)
-			result := crawler.buildAbsolutePath(tt.link)
-			assert.Equal(t, tt.expected, result)
+			assert.NoError(t, test.crawl(NewCrawler(server.URL, publisher)))
+			assert.ElementsMatch(t, expectedChains, publisher.Redirects)
+			crawled := make([]string, 0, len(publisher.Meta))
+			for url := range publisher.Meta {
+				crawled = append(crawled, url)
+			}
+			assert.Equal(t, []string{server.URL + "/"}, crawled)
+			assert.Zero(t, offSiteRequests.Load())
+			assert.Zero(t, secretRequests.Load())
+		})
+	}
+}
+
+// newEndlessSite serves pages which always link to two new ones,
+// cancelling once the given amount of pages was served.
+func newEndlessSite(t *testing.T, cancelAfter int32, cancel context.CancelFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var pageCount atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		n := pageCount.Add(1)
+		if n == cancelAfter {
+			cancel()
+		}
+		_, _ = fmt.Fprintf(w, `<a href="/%d-a">a</a><a href="/%d-b">b</a>`, n, n)
+	}))
+	t.Cleanup(server.Close)
+	return server, &pageCount
+}
+
+func TestCrawler_CrawlParallelContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, pageCount := newEndlessSite(t, 5, cancel)
+
+	publisher := publish.NewTestPublisher()
+	crawler := NewCrawler(server.URL, publisher, WithPoliteness(Politeness{MaxPerHost: 4}))
+	err := crawler.CrawlParallelContext(ctx, 4)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotEmpty(t, publisher.Published)
+	assert.Less(t, pageCount.Load(), int32(20))
+}
+
+func TestCrawler_CrawlContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, pageCount := newEndlessSite(t, 5, cancel)
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher, WithPoliteness(Politeness{MaxPerHost: 1})).CrawlContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotEmpty(t, publisher.Published)
+	// the first page is fetched twice, once to check it's reachable
+	assert.Equal(t, int32(5), pageCount.Load())
+}
+
+func TestCrawler_Cancelled_AbortsRobots(t *testing.T) {
+	tests := []struct {
+		name  string
+		crawl func(ctx context.Context, c *Crawler) error
+	}{
+		{name: "sequential", crawl: func(ctx context.Context, c *Crawler) error { return c.CrawlContext(ctx) }},
+		{name: "parallel", crawl: func(ctx context.Context, c *Crawler) error { return c.CrawlParallelContext(ctx, 2) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aborted := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					<-r.Context().Done()
+					close(aborted)
+					return
+				}
+				_, _ = w.Write([]byte(`<a href="/about">About</a>`))
+			}))
+			defer server.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			err := test.crawl(ctx, NewCrawler(server.URL, publish.NewTestPublisher()))
+			assert.ErrorIs(t, err, context.Canceled)
+			select {
+			case <-aborted:
+			case <-time.After(time.Second):
+				t.Fatal("the robots.txt request was still going on after the crawl was cancelled")
+			}
 		})
 	}
 }
+
+func TestCrawler_CrawlParallelContext_CancelledLeavesNothingBehind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var pages atomic.Int32
+	// an endless site which doesn't go through the network, so no connection is left open either
+	fetcher := fetcherFunc(func(ctx context.Context, url string) crawlhttp.FetchResult {
+		if strings.HasSuffix(url, "/robots.txt") {
+			return crawlhttp.FetchResult{URL: url, StatusCode: http.StatusNotFound}
+		}
+		if pages.Add(1) == 5 {
+			cancel()
+		}
+		body := fmt.Sprintf(`<a href="%[1]s/a">a</a><a href="%[1]s/b">b</a>`, url)
+		return crawlhttp.FetchResult{URL: url, StatusCode: http.StatusOK, ContentType: "text/html", Body: io.NopCloser(strings.NewReader(body))}
+	})
+	before := runtime.NumGoroutine()
+
+	err := NewCrawler("http://example.com", publish.NewTestPublisher(), WithFetcher(fetcher), WithPoliteness(Politeness{MaxPerHost: 2})).
+		CrawlParallelContext(ctx, 4)
+	assert.ErrorIs(t, err, context.Canceled)
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines were left behind by the cancelled crawl")
+}
+
+func TestCrawler_MaxDepthAndMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/one">Level one</a>`))
+		case "/one":
+			_, _ = w.Write([]byte(`<a href="/two">Level <b>two</b></a>`))
+		case "/two":
+			_, _ = w.Write([]byte(`<a href="/three">Level three</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	expected := map[string]publish.Meta{
+		server.URL + "/":    {Depth: 0},
+		server.URL + "/one": {Depth: 1, Parent: server.URL + "/", AnchorText: "Level one"},
+		server.URL + "/two": {Depth: 2, Parent: server.URL + "/one", AnchorText: "Level two"},
+	}
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher, WithMaxDepth(2)).Crawl()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, howFound(publisher.Meta))
+
+	publisher = publish.NewTestPublisher()
+	err = NewCrawler(server.URL, publisher, WithMaxDepth(2)).CrawlParallel(2)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, howFound(publisher.Meta))
+	assert.Equal(t, http.StatusOK, publisher.Meta[server.URL+"/two"].StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", publisher.Meta[server.URL+"/two"].ContentType)
+	assert.Positive(t, publisher.Meta[server.URL+"/two"].Duration)
+}
+
+// howFound leaves out how fetching went from the metas, keeping only how the pages were found.
+func howFound(metas map[string]publish.Meta) map[string]publish.Meta {
+	found := make(map[string]publish.Meta, len(metas))
+	for url, meta := range metas {
+		found[url] = publish.Meta{Depth: meta.Depth, Parent: meta.Parent, AnchorText: meta.AnchorText}
+	}
+	return found
+}
+
+func TestCrawler_RecordsWhereBrokenLinksWereFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(`<a href="/missing">Broken</a>`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher).CrawlParallel(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []publish.Link{{URL: server.URL + "/missing", AnchorText: "Broken", Internal: true}}, publisher.Meta[server.URL+"/"].Links)
+	missing := publisher.Meta[server.URL+"/missing"]
+	assert.Equal(t, publish.Meta{Depth: 1, Parent: server.URL + "/", AnchorText: "Broken"}, howFound(publisher.Meta)[server.URL+"/missing"])
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestCrawler_Budgets(t *testing.T) {
+	tests := []struct {
+		name           string
+		budget         Budget
+		expectedReason string
+		expectedPages  int
+		cappedHosts    bool
+	}{
+		{
+			name:           "max_pages",
+			budget:         Budget{MaxPages: 5},
+			expectedReason: "max pages of 5",
+			expectedPages:  5,
+		},
+		{
+			name:          "max_pages_per_host",
+			budget:        Budget{MaxPagesPerHost: 3},
+			expectedPages: 3,
+			cappedHosts:   true,
+		},
+		{
+			name:           "max_bytes",
+			budget:         Budget{MaxBytes: 1},
+			expectedReason: "max bytes of 1",
+			expectedPages:  1,
+		},
+		{
+			name:           "max_duration",
+			budget:         Budget{MaxDuration: 300 * time.Millisecond},
+			expectedReason: "max duration of 300ms",
+			expectedPages:  -1,
+		},
+	}
+	politeness := Politeness{MinDelay: 50 * time.Millisecond, MaxPerHost: 1}
+
+	for _, test := range tests {
+		crawls := map[string]func(c *Crawler) error{
+			"sequential": func(c *Crawler) error { return c.Crawl() },
+			"parallel":   func(c *Crawler) error { return c.CrawlParallel(4) },
+		}
+		for mode, crawl := range crawls {
+			t.Run(test.name+"_"+mode, func(t *testing.T) {
+				server, _ := newEndlessSite(t, 0, func() {})
+				publisher := publish.NewTestPublisher()
+				crawler := NewCrawler(server.URL, publisher, WithBudget(test.budget), WithPoliteness(politeness))
+
+				err := crawl(crawler)
+
+				assert.NoError(t, err)
+				if assert.NotNil(t, publisher.Summary) {
+					assert.Equal(t, test.expectedReason, publisher.Summary.StopReason)
+					if test.cappedHosts {
+						assert.Equal(t, []string{hostOf(server.URL)}, publisher.Summary.CappedHosts)
+					} else {
+						assert.Empty(t, publisher.Summary.CappedHosts)
+					}
+				}
+				if test.expectedPages >= 0 {
+					assert.Len(t, publisher.Meta, test.expectedPages)
+				}
+			})
+		}
+	}
+}
+
+func TestCrawler_CrawlParallel_DiskFrontier(t *testing.T) {
+	server, pageCount := newEndlessSite(t, 0, func() {})
+	publisher := publish.NewTestPublisher()
+	dir := t.TempDir()
+	crawler := NewCrawler(server.URL, publisher,
+		WithBudget(Budget{MaxPages: 20}),
+		WithPoliteness(Politeness{MaxPerHost: 2}),
+		WithFrontier(func() (Frontier, error) {
+			return NewDiskFrontier(dir, 4)
+		}),
+	)
+
+	err := crawler.CrawlParallel(2)
+
+	assert.NoError(t, err)
+	assert.Len(t, publisher.Meta, 20)
+	assert.EqualValues(t, 20, pageCount.Load())
+	// the segments are cleaned up once the crawl is over
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCrawler_CrawlParallel_DiskFrontierThrottled(t *testing.T) {
+	const links, maxPending = 2000, 50
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			return
+		}
+		for i := 0; i < links; i++ {
+			_, _ = fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+		}
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var frontier *DiskFrontier
+	var fetched atomic.Int32
+	var queuedAfter20 atomic.Int64
+	publisher := publish.NewTestPublisher()
+	crawler := NewCrawler(server.URL, publisher,
+		WithPoliteness(Politeness{MinDelay: 10 * time.Millisecond, MaxPerHost: 1, MaxPending: maxPending}),
+		WithFrontier(func() (Frontier, error) {
+			var err error
+			frontier, err = NewDiskFrontier(t.TempDir(), 100)
+			return frontier, err
+		}),
+		WithHooks(Hooks{BeforeFetch: func(Task) bool {
+			if fetched.Add(1) == 20 {
+				queuedAfter20.Store(int64(frontier.Len()))
+				cancel()
+			}
+			return true
+		}}),
+	)
+
+	err := crawler.CrawlParallelContext(ctx, 4)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	// the scheduler only takes in maxPending tasks, the others wait on disk until a host can take them
+	assert.Positive(t, queuedAfter20.Load())
+	assert.GreaterOrEqual(t, queuedAfter20.Load(), int64(links-maxPending-20-1))
+}
+
+func TestCrawler_VisitedSets(t *testing.T) {
+	tests := []struct {
+		name          string
+		crawl         func(c *Crawler) error
+		expectedNames []string
+	}{
+		{name: "sequential", crawl: func(c *Crawler) error { return c.Crawl() }, expectedNames: []string{"seen"}},
+		{name: "parallel", crawl: func(c *Crawler) error { return c.CrawlParallel(2) }, expectedNames: []string{"queued", "visited"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newChainSite(t, 6)
+			publisher := publish.NewTestPublisher()
+			crawler := NewCrawler(server.URL, publisher, WithVisitedSet(func() visited.Set {
+				return visited.NewScalableBloom(2, 0.001)
+			}))
+
+			err := test.crawl(crawler)
+
+			assert.NoError(t, err)
+			assert.Len(t, publisher.Meta, 6)
+			names := make([]string, 0)
+			for _, set := range publisher.Summary.VisitedSets {
+				names = append(names, set.Name)
+				assert.Equal(t, visited.KindBloom, set.Kind)
+				assert.Equal(t, 6, set.Count)
+				assert.Positive(t, set.MemoryBytes)
+			}
+			assert.Equal(t, test.expectedNames, names)
+		})
+	}
+}
+
+func TestCrawler_IndexingMeta(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Last-Modified", "Wed, 01 May 2024 10:30:00 GMT")
+			_, _ = w.Write([]byte(`<base href="/docs/"><link rel="canonical" href="../"><a href="copy">Copy</a>`))
+		case "/docs/copy":
+			_, _ = w.Write([]byte(`<link rel="canonical" href="/"><meta name="robots" content="noindex">`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(server.URL, publisher).CrawlParallel(2)
+	assert.NoError(t, err)
+
+	home := publisher.Meta[server.URL+"/"]
+	assert.Equal(t, server.URL+"/", home.Canonical)
+	assert.False(t, home.NoIndex)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), home.LastModified)
+	copied := publisher.Meta[server.URL+"/docs/copy"]
+	assert.Equal(t, server.URL+"/", copied.Canonical)
+	assert.True(t, copied.NoIndex)
+	assert.True(t, copied.LastModified.IsZero())
+}
+
+// fetcherFunc is a links.Fetcher which isn't an *http.Fetcher.
+type fetcherFunc func(ctx context.Context, url string) crawlhttp.FetchResult
+
+func (f fetcherFunc) FetchContext(ctx context.Context, url string) crawlhttp.FetchResult {
+	return f(ctx, url)
+}
+
+func TestCrawler_WithFetcher(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"robots.txt":   "User-agent: *\nDisallow: /private\n",
+		"index.html":   `<a href="/guide.html">Guide</a><a href="/private.html">Private</a>`,
+		"guide.html":   `<a href="/">Home</a><a href="/missing.html">Missing</a>`,
+		"private.html": `<h1>Private</h1>`,
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o644))
+	}
+	var mu sync.Mutex
+	var fetched []string
+	local := crawlhttp.NewFileFetcher(root)
+	fetcher := fetcherFunc(func(ctx context.Context, url string) crawlhttp.FetchResult {
+		mu.Lock()
+		fetched = append(fetched, url)
+		mu.Unlock()
+		return local.FetchContext(ctx, url)
+	})
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler("http://docs.example.com", publisher, WithFetcher(fetcher)).CrawlParallel(2)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"http://docs.example.com/robots.txt",
+		"http://docs.example.com/",
+		"http://docs.example.com/guide.html",
+		"http://docs.example.com/missing.html",
+	}, fetched)
+	assert.Equal(t, http.StatusOK, publisher.Meta["http://docs.example.com/guide.html"].StatusCode)
+	assert.Equal(t, http.StatusNotFound, publisher.Meta["http://docs.example.com/missing.html"].StatusCode)
+}
+
+func TestResolveErrType(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected publish.ErrType
+	}{
+		{name: "not found", err: fetchErr(t, http.StatusNotFound), expected: publish.ErrTypeNotFound},
+		{name: "gone", err: fetchErr(t, http.StatusGone), expected: publish.ErrTypeNotFound},
+		{name: "unauthorized", err: fetchErr(t, http.StatusUnauthorized), expected: publish.ErrTypeNoAccess},
+		{name: "rate limited", err: fetchErr(t, http.StatusTooManyRequests), expected: publish.ErrTypeRateLimited},
+		{name: "teapot", err: fetchErr(t, http.StatusTeapot), expected: publish.ErrTypeClient},
+		{name: "bad gateway", err: fetchErr(t, http.StatusBadGateway), expected: publish.ErrTypeInternal},
+		{name: "accepted", err: fetchErr(t, http.StatusAccepted), expected: publish.ErrTypeStatus},
+		{name: "redirect loop", err: fmt.Errorf("%w: /a was already visited", crawlhttp.ErrRedirectLoop), expected: publish.ErrTypeRedirect},
+		{name: "timeout", err: &crawlhttp.TimeoutError{Err: context.DeadlineExceeded}, expected: publish.ErrTypeTimeout},
+		{name: "dns", err: &crawlhttp.DNSError{Host: "nope.invalid", Err: errors.New("no such host")}, expected: publish.ErrTypeDNS},
+		{name: "connection", err: &crawlhttp.ConnectionError{Err: errors.New("connection refused")}, expected: publish.ErrTypeConnection},
+		{name: "tls", err: &crawlhttp.TLSError{Err: errors.New("certificate expired")}, expected: publish.ErrTypeTLS},
+		{name: "too large", err: fmt.Errorf("reading: %w", &crawlhttp.TooLargeError{Limit: 10}), expected: publish.ErrTypeTooLarge},
+		{name: "parse", err: &crawlhttp.ParseError{Err: errors.New("bad html")}, expected: publish.ErrTypeParse},
+		{name: "unknown", err: errors.New("something else"), expected: publish.ErrTypeUnknown},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, resolveErrType(test.err))
+		})
+	}
+}
+
+// fetchErr is the error of fetching a page which responds with the status.
+func fetchErr(t *testing.T, status int) error {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	return crawlhttp.NewFetcher().Fetch(server.URL).Err
+}
+
+// dataHrefExtractor extracts `<button data-href="...">`.
+type dataHrefExtractor struct{}
+
+func (e dataHrefExtractor) Extract(node *html.Node) (string, bool) {
+	if node.Type == html.ElementNode && node.Data == "button" {
+		for _, attr := range node.Attr {
+			if attr.Key == "data-href" {
+				return attr.Val, true
+			}
+		}
+	}
+	return "", false
+}
+
+// notPrefixed lets through the links which aren't under the path prefix.
+type notPrefixed string
+
+func (p notPrefixed) Match(link string) bool {
+	return !strings.Contains(link, string(p))
+}
+
+func TestCrawler_Options(t *testing.T) {
+	var mu sync.Mutex
+	userAgents := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents[r.UserAgent()] = true
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: mybot\nDisallow: /private\n\nUser-agent: *\nDisallow: /\n"))
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/a">A</a><button data-href="/b">B</button><a href="/drafts/c">C</a><a href="/private">Private</a><a href="/hooked">Hooked</a>`))
+		default:
+			_, _ = w.Write([]byte(`<html></html>`))
+		}
+	}))
+	defer server.Close()
+
+	var beforeFetch, afterFetch sync.Map
+	publisher := publish.NewTestPublisher()
+	crawler := NewCrawler(server.URL, publisher,
+		WithWorkers(3),
+		WithUserAgent("MyBot/1.0 (+https://example.com/bot)"),
+		WithExtraFilters(notPrefixed("/drafts/")),
+		WithExtraExtractors(dataHrefExtractor{}),
+		WithHooks(Hooks{
+			BeforeFetch: func(task Task) bool {
+				beforeFetch.Store(task.URL, true)
+				return !strings.HasSuffix(task.URL, "/hooked")
+			},
+			AfterFetch: func(task Task, page *links.Page, err error) {
+				assert.NoError(t, err)
+				afterFetch.Store(task.URL, page.StatusCode)
+			},
+		}),
+	)
+	err := crawler.CrawlContext(context.Background())
+	assert.NoError(t, err)
+
+	crawled := []string{server.URL + "/", server.URL + "/a", server.URL + "/b"}
+	for _, url := range crawled {
+		assert.Contains(t, publisher.Meta, url)
+		status, fetched := afterFetch.Load(url)
+		assert.True(t, fetched, url)
+		assert.Equal(t, http.StatusOK, status)
+	}
+	assert.Len(t, publisher.Meta, len(crawled))
+	_, checked := beforeFetch.Load(server.URL + "/hooked")
+	assert.True(t, checked)
+	_, fetched := afterFetch.Load(server.URL + "/hooked")
+	assert.False(t, fetched)
+	assert.Equal(t, map[string]bool{"MyBot/1.0 (+https://example.com/bot)": true}, userAgents)
+}
+
+func TestCrawler_WithFilters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /\n"))
+		case "/":
+			_, _ = w.Write([]byte(`<a href="/a">A</a><a href="/drafts/b">B</a>`))
+		default:
+			_, _ = w.Write([]byte(`<html></html>`))
+		}
+	}))
+	defer server.Close()
+
+	publisher := publish.NewTestPublisher()
+	// robots.txt isn't part of the filters given
+	err := NewCrawler(server.URL, publisher, WithFilters(notPrefixed("/drafts/"))).Crawl()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{server.URL + "/", server.URL + "/a", server.URL + "/drafts/b", server.URL + "/a"}, publisher.Published)
+}
+
+func TestCrawler_MultipleSeedsAndScope(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html"}}
+	fetcher := crawlhttp.NewFixtureFetcher([]crawlhttp.Fixture{
+		{URL: "http://example.com/", StatusCode: http.StatusOK, Header: html,
+			Body: `<a href="http://blog.example.com/">Blog</a><a href="http://other.com/">Other</a><a href="/gone">Gone</a>`},
+		{URL: "http://docs.example.com/", StatusCode: http.StatusOK, Header: html,
+			Body: `<a href="/guide">Guide</a><a href="http://example.com/">Home</a>`},
+		{URL: "http://docs.example.com/guide", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://blog.example.com/", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://other.com/", StatusCode: http.StatusOK, Header: html},
+	})
+	scope, err := filters.NewScope("example.com", "*.example.com")
+	assert.NoError(t, err)
+
+	publisher := publish.NewTestPublisher()
+	crawler := NewCrawler("example.com", publisher,
+		WithSeeds("http://docs.example.com", "http://example.com/"),
+		WithScope(scope),
+		WithFetcher(fetcher),
+	)
+	err = crawler.Crawl()
+	assert.NoError(t, err)
+
+	seeds := map[string]string{}
+	for url, meta := range publisher.Meta {
+		seeds[url] = meta.Seed
+	}
+	assert.Equal(t, map[string]string{
+		"http://example.com/":           "http://example.com/",
+		"http://blog.example.com/":      "http://example.com/",
+		"http://example.com/gone":       "http://example.com/",
+		"http://docs.example.com/":      "http://docs.example.com/",
+		"http://docs.example.com/guide": "http://docs.example.com/",
+	}, seeds)
+	home := publisher.Meta["http://example.com/"]
+	assert.Equal(t, []publish.Link{
+		{URL: "http://blog.example.com/", AnchorText: "Blog", Internal: true},
+		{URL: "http://other.com/", AnchorText: "Other"},
+		{URL: "http://example.com/gone", AnchorText: "Gone", Internal: true},
+	}, home.Links)
+}
+
+func TestCrawler_SeedsScopeByDefault(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html></html>`))
+	}))
+	defer other.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html></html>`))
+	}))
+	defer second.Close()
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="%s/">Second</a><a href="%s/">Other</a>`, second.URL, other.URL)
+	}))
+	defer first.Close()
+
+	publisher := publish.NewTestPublisher()
+	err := NewCrawler(first.URL, publisher, WithSeeds(second.URL)).CrawlParallel(2)
+	assert.NoError(t, err)
+	assert.Equal(t, first.URL+"/", publisher.Meta[first.URL+"/"].Seed)
+	// a page reached from several seeds counts for the one which got there first, the seed itself here
+	assert.Equal(t, second.URL+"/", publisher.Meta[second.URL+"/"].Seed)
+	assert.NotContains(t, publisher.Meta, other.URL+"/")
+}
+
+func TestCrawler_ScopeMode(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html"}}
+	fetcher := crawlhttp.NewFixtureFetcher([]crawlhttp.Fixture{
+		{URL: "http://www.example.co.uk/", StatusCode: http.StatusOK, Header: html,
+			Body: `<a href="http://blog.example.co.uk/">Blog</a><a href="http://other.co.uk/">Other</a><a href="http://example.co.uk/">Bare</a>`},
+		{URL: "http://blog.example.co.uk/", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://example.co.uk/", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://other.co.uk/", StatusCode: http.StatusOK, Header: html},
+	})
+	tests := []struct {
+		name     string
+		mode     filters.ScopeMode
+		expected []string
+	}{
+		{name: "default", expected: []string{"http://www.example.co.uk/", "http://example.co.uk/"}},
+		{mode: filters.ScopeHost, expected: []string{"http://www.example.co.uk/"}},
+		{mode: filters.ScopeHostWWW, expected: []string{"http://www.example.co.uk/", "http://example.co.uk/"}},
+		{mode: filters.ScopeDomain, expected: []string{"http://www.example.co.uk/", "http://blog.example.co.uk/", "http://example.co.uk/"}},
+	}
+	for _, test := range tests {
+		name := test.name
+		opts := []Option{WithFetcher(fetcher)}
+		if test.mode != "" {
+			name = string(test.mode)
+			opts = append(opts, WithScopeMode(test.mode))
+		}
+		t.Run(name, func(t *testing.T) {
+			publisher := publish.NewTestPublisher()
+			err := NewCrawler("http://www.example.co.uk/", publisher, opts...).Crawl()
+			assert.NoError(t, err)
+			crawled := make([]string, 0, len(publisher.Meta))
+			for url := range publisher.Meta {
+				crawled = append(crawled, url)
+			}
+			assert.ElementsMatch(t, test.expected, crawled)
+		})
+	}
+}
+
+func TestCrawler_WithRules(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html"}}
+	fetcher := crawlhttp.NewFixtureFetcher([]crawlhttp.Fixture{
+		{URL: "http://example.com/", StatusCode: http.StatusOK, Header: html,
+			Body: `<a href="/docs/">Docs</a><a href="/admin/">Admin</a><a href="/blog/">Blog</a>`},
+		{URL: "http://example.com/docs/", StatusCode: http.StatusOK, Header: html,
+			Body: `<a href="/docs/guide">Guide</a><a href="/docs/search?q=spider">Search</a>`},
+		{URL: "http://example.com/docs/guide", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://example.com/docs/search?q=spider", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://example.com/admin/", StatusCode: http.StatusOK, Header: html},
+		{URL: "http://example.com/blog/", StatusCode: http.StatusOK, Header: html},
+	})
+	include, err := filters.NewRule(true, "glob:/docs/**")
+	assert.NoError(t, err)
+	exclude, err := filters.NewRule(false, `re:/search\?q=`)
+	assert.NoError(t, err)
+
+	publisher := publish.NewTestPublisher()
+	err = NewCrawler("http://example.com/", publisher, WithFetcher(fetcher), WithRules(filters.NewRules(include, exclude))).Crawl()
+	assert.NoError(t, err)
+	crawled := make([]string, 0, len(publisher.Meta))
+	for url := range publisher.Meta {
+		crawled = append(crawled, url)
+	}
+	// the seed is crawled whatever the rules
+	assert.ElementsMatch(t, []string{"http://example.com/", "http://example.com/docs/", "http://example.com/docs/guide"}, crawled)
+}
+
+func TestCrawler_Explain(t *testing.T) {
+	fetcher := crawlhttp.NewFixtureFetcher([]crawlhttp.Fixture{
+		{URL: "http://example.com/robots.txt", StatusCode: http.StatusOK, Body: "User-agent: *\nDisallow: /docs/private/"},
+	})
+	include, err := filters.NewRule(true, "glob:/docs/**")
+	assert.NoError(t, err)
+	exclude, err := filters.NewRule(false, "glob:/docs/drafts/**")
+	assert.NoError(t, err)
+	crawler := NewCrawler("http://example.com/", publish.NewTestPublisher(), WithFetcher(fetcher), WithRules(filters.NewRules(include, exclude)))
+
+	tests := []struct {
+		link      string
+		crawlable bool
+		rule      string
+		filter    string
+	}{
+		{link: "http://example.com/docs/guide", crawlable: true, rule: "include glob:/docs/**"},
+		{link: "http://example.com/docs/drafts/next", rule: "exclude glob:/docs/drafts/**"},
+		{link: "http://example.com/blog/"},
+		{link: "http://other.com/docs/guide", rule: "include glob:/docs/**", filter: "scope example.com, www.example.com"},
+		{link: "http://example.com/docs/manual.pdf", rule: "include glob:/docs/**", filter: "filters.NotFile"},
+		{link: "http://example.com/docs/private/a", rule: "include glob:/docs/**", filter: "robots.txt"},
+	}
+	for _, test := range tests {
+		decision := crawler.Explain(context.Background(), test.link)
+		assert.Equal(t, test.crawlable, decision.Crawlable, test.link)
+		rule, filter := "", ""
+		if decision.Rule != nil {
+			rule = decision.Rule.String()
+		}
+		if decision.Filter != nil {
+			filter = filters.Describe(decision.Filter)
+		}
+		assert.Equal(t, test.rule, rule, test.link)
+		assert.Equal(t, test.filter, filter, test.link)
+	}
+}
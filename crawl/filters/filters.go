@@ -1,6 +1,8 @@
 package filters
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"strings"
 )
@@ -10,12 +12,35 @@ import (
 // which could be modified in the future as we find out more cases
 // ## FOR FUTURE:
 // - we could add filters for file links
-// - add filters according to robots.txt
 type Filter interface {
 	// Match function takes the links and returns true only if the link matches the criteria specified.
 	Match(string) bool
 }
 
+// ContextFilter is a Filter which might have to make requests to decide, e.g. for robots.txt,
+// MatchContext gives up on them once the context is done.
+type ContextFilter interface {
+	Filter
+	MatchContext(ctx context.Context, link string) bool
+}
+
+// MatchContext matches the link with MatchContext when the filter is a ContextFilter, with Match otherwise.
+func MatchContext(ctx context.Context, filter Filter, link string) bool {
+	if contextFilter, ok := filter.(ContextFilter); ok {
+		return contextFilter.MatchContext(ctx, link)
+	}
+	return filter.Match(link)
+}
+
+// Describe names the filter e.g. to tell which one rejected a link,
+// with its String method when it has one or its type otherwise e.g. "filters.NotFile".
+func Describe(filter Filter) string {
+	if stringer, ok := filter.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", filter), "*")
+}
+
 func SanitizeLink(link string) string {
 	link = strings.Trim(link, " ")
 	link = strings.TrimSuffix(link, "#")
@@ -47,7 +72,15 @@ type internalLink struct {
 	baseDomain string
 }
 
+// NewInternalLink stays on the host of baseUrl, it's the Scope of ScopeHostWWW
+// unless baseUrl has no host it can be made of, it's then compared with as it is.
 func NewInternalLink(baseUrl string) Filter {
+	if !strings.Contains(baseUrl, "://") {
+		baseUrl = "http://" + baseUrl
+	}
+	if scope, err := ScopeOf(ScopeHostWWW, baseUrl); err == nil {
+		return scope
+	}
 	baseUrl = SanitizeLink(baseUrl)
 	// split is guaranteed to return 1 element
 	baseDomain := strings.Split(baseUrl, "/")[0]
@@ -74,6 +107,10 @@ func (l *internalLink) Match(link string) bool {
 	return linkDomain == l.baseDomain
 }
 
+func (l *internalLink) String() string {
+	return "scope " + l.baseDomain
+}
+
 type NotEmpty struct{}
 
 func (e *NotEmpty) Match(link string) bool {
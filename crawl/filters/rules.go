@@ -0,0 +1,169 @@
+package filters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RuleKind is how the pattern of a rule is matched.
+type RuleKind string
+
+const (
+	// RuleGlob is matched against the whole url, or its path and query when the glob starts with "/".
+	// `**` matches anything, `*` anything but "/" and `?` any single character but "/"
+	RuleGlob RuleKind = "glob"
+	// RuleRegex is found anywhere in the url unless it's anchored
+	RuleRegex RuleKind = "re"
+)
+
+// Rule includes or excludes the urls matching its pattern, e.g. "glob:/docs/**" or "re:/search\?q=".
+type Rule struct {
+	Include bool
+	Kind    RuleKind
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// NewRule parses the pattern, prefixed with its kind i.e. "glob:" or "re:", a glob when it has no prefix.
+func NewRule(include bool, pattern string) (Rule, error) {
+	rule := Rule{Include: include, Kind: RuleGlob, Pattern: pattern}
+	if kind, rest, found := strings.Cut(pattern, ":"); found && (kind == string(RuleGlob) || kind == string(RuleRegex)) {
+		rule.Kind, rule.Pattern = RuleKind(kind), rest
+	}
+	if rule.Pattern == "" {
+		return Rule{}, fmt.Errorf("invalid rule %q: the pattern is empty", pattern)
+	}
+	expr := rule.Pattern
+	if rule.Kind == RuleGlob {
+		expr = globToRegex(rule.Pattern)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %w", pattern, err)
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// globToRegex anchors the glob, the other regex characters are escaped.
+func globToRegex(glob string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+// Matches tells whether the url is matched by the pattern of the rule.
+func (r Rule) Matches(link string) bool {
+	if r.Kind == RuleGlob && strings.HasPrefix(r.Pattern, "/") {
+		u, err := url.Parse(link)
+		if err != nil {
+			return false
+		}
+		link = u.EscapedPath()
+		if u.RawQuery != "" {
+			link += "?" + u.RawQuery
+		}
+	}
+	return r.re.MatchString(link)
+}
+
+// String is the rule as it's written in a rules file e.g. "exclude glob:/admin/**".
+func (r Rule) String() string {
+	action := "exclude"
+	if r.Include {
+		action = "include"
+	}
+	return fmt.Sprintf("%s %s:%s", action, r.Kind, r.Pattern)
+}
+
+// Rules lets through the urls which aren't excluded by any rule and, when there are include rules, are included by one.
+type Rules struct {
+	includes []Rule
+	excludes []Rule
+}
+
+func NewRules(rules ...Rule) *Rules {
+	r := &Rules{}
+	for _, rule := range rules {
+		if rule.Include {
+			r.includes = append(r.includes, rule)
+		} else {
+			r.excludes = append(r.excludes, rule)
+		}
+	}
+	return r
+}
+
+func (r *Rules) Match(link string) bool {
+	accepted, _ := r.Decide(link)
+	return accepted
+}
+
+// Decide returns whether the url is accepted along with the rule which decided it,
+// nil when no exclude rule matched and there's no include rule, or when none of the include rules matched.
+func (r *Rules) Decide(link string) (bool, *Rule) {
+	for i := range r.excludes {
+		if r.excludes[i].Matches(link) {
+			return false, &r.excludes[i]
+		}
+	}
+	for i := range r.includes {
+		if r.includes[i].Matches(link) {
+			return true, &r.includes[i]
+		}
+	}
+	return len(r.includes) == 0, nil
+}
+
+// Empty tells whether there are no rules at all.
+func (r *Rules) Empty() bool {
+	return len(r.includes) == 0 && len(r.excludes) == 0
+}
+
+// ParseRules reads a rule per line, "include" or "exclude" followed by the pattern of NewRule e.g.
+//
+//	# only the docs, without the search pages
+//	include glob:/docs/**
+//	exclude re:/search\?q=
+//
+// empty lines and the ones starting with # are ignored.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		action, pattern, _ := strings.Cut(text, " ")
+		if action != "include" && action != "exclude" {
+			return nil, fmt.Errorf("line %d: expected include or exclude, not %q", line, action)
+		}
+		rule, err := NewRule(action == "include", strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+var _ Filter = (*Rules)(nil)
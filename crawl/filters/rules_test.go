@@ -0,0 +1,90 @@
+package filters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRule_Matches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		link     string
+		expected bool
+	}{
+		{pattern: "glob:/docs/**", link: "https://example.com/docs/guide/install", expected: true},
+		{pattern: "/docs/**", link: "https://example.com/docs/", expected: true},
+		{pattern: "/docs/**", link: "https://example.com/docs", expected: false},
+		{pattern: "/docs/**", link: "https://example.com/blog/docs/a", expected: false},
+		{pattern: "/docs/*", link: "https://example.com/docs/guide", expected: true},
+		{pattern: "/docs/*", link: "https://example.com/docs/guide/install", expected: false},
+		{pattern: "/search?q=*", link: "https://example.com/search?q=spider", expected: true},
+		{pattern: "/search?q=*", link: "https://example.com/search", expected: false},
+		{pattern: "/file.html", link: "https://example.com/fileXhtml", expected: false},
+		{pattern: "/docs/v?/**", link: "https://example.com/docs/v2/guide", expected: true},
+		{pattern: "/docs/v?/**", link: "https://example.com/docs/v/guide", expected: false},
+		{pattern: "/a?c", link: "https://example.com/a/c", expected: false},
+		{pattern: "https://*.example.com/**", link: "https://docs.example.com/a/b", expected: true},
+		{pattern: "https://*.example.com/**", link: "https://example.com/a", expected: false},
+		{pattern: "re:/admin", link: "https://example.com/admin/users", expected: true},
+		{pattern: "re:/admin", link: "https://example.com/administrators", expected: true},
+		{pattern: `re:^https://example\.com/admin(/|$)`, link: "https://example.com/administrators", expected: false},
+		{pattern: `re:/search\?q=`, link: "https://example.com/search?q=spider", expected: true},
+	}
+	for _, test := range tests {
+		rule, err := NewRule(true, test.pattern)
+		assert.NoError(t, err, test.pattern)
+		assert.Equal(t, test.expected, rule.Matches(test.link), "%s on %s", test.pattern, test.link)
+	}
+}
+
+func TestNewRule_Invalid(t *testing.T) {
+	for _, pattern := range []string{"", "glob:", "re:", "re:(unclosed"} {
+		_, err := NewRule(false, pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestRules_Decide(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# only the docs, without the search pages
+include glob:/docs/**
+exclude re:/search\?q=
+`))
+	assert.NoError(t, err)
+	set := NewRules(rules...)
+	tests := []struct {
+		link     string
+		accepted bool
+		rule     string
+	}{
+		{link: "https://example.com/docs/guide", accepted: true, rule: "include glob:/docs/**"},
+		{link: "https://example.com/docs/search?q=spider", accepted: false, rule: `exclude re:/search\?q=`},
+		{link: "https://example.com/blog", accepted: false},
+	}
+	for _, test := range tests {
+		accepted, rule := set.Decide(test.link)
+		assert.Equal(t, test.accepted, accepted, test.link)
+		assert.Equal(t, test.accepted, set.Match(test.link), test.link)
+		if test.rule == "" {
+			assert.Nil(t, rule, test.link)
+		} else if assert.NotNil(t, rule, test.link) {
+			assert.Equal(t, test.rule, rule.String())
+		}
+	}
+
+	excludeOnly := NewRules(rules[1])
+	accepted, rule := excludeOnly.Decide("https://example.com/blog")
+	assert.True(t, accepted)
+	assert.Nil(t, rule)
+	assert.False(t, excludeOnly.Empty())
+	assert.True(t, NewRules().Empty())
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	for _, content := range []string{"skip glob:/admin", "exclude", "include re:(unclosed"} {
+		_, err := ParseRules(strings.NewReader(content))
+		assert.Error(t, err, content)
+	}
+}
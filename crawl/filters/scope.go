@@ -0,0 +1,170 @@
+package filters
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ScopeMode is how far from the hosts of the seeds a crawl goes.
+type ScopeMode string
+
+const (
+	// ScopeHost stays on the hosts of the seeds exactly, their ports included
+	ScopeHost ScopeMode = "host"
+	// ScopeHostWWW is ScopeHost where a host with and without www. are the same e.g. www.example.com and example.com,
+	// it's the default scope of a crawl
+	ScopeHostWWW ScopeMode = "host-www"
+	// ScopeDomain stays on the registrable domains of the seeds i.e. their eTLD+1 according to the public suffix list,
+	// e.g. blog.example.co.uk for a seed on example.co.uk, but not other.co.uk
+	ScopeDomain ScopeMode = "domain"
+	// ScopeSubdomains stays on the hosts of the seeds and their subdomains, e.g. blog.docs.example.com for docs.example.com
+	ScopeSubdomains ScopeMode = "subdomains"
+)
+
+// ScopeOf returns the scope of a crawl starting from the seeds.
+// the hosts of the seeds which have no registrable domain, such as ip addresses and localhost, are kept as they are.
+// the domain and subdomains modes are on any port, like "*." patterns.
+func ScopeOf(mode ScopeMode, seeds ...string) (*Scope, error) {
+	patterns := make([]string, 0, 3*len(seeds))
+	for _, seed := range seeds {
+		if mode == ScopeHost {
+			patterns = append(patterns, seed)
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(seed))
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid seed %q", seed)
+		}
+		host := strings.ToLower(u.Host)
+		hostname := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		switch mode {
+		case ScopeHostWWW:
+			if bare, found := strings.CutPrefix(host, "www."); found {
+				patterns = append(patterns, host, bare)
+			} else {
+				patterns = append(patterns, host, "www."+host)
+			}
+		case ScopeDomain:
+			domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+			if err != nil || net.ParseIP(hostname) != nil {
+				// e.g. localhost or a public suffix itself
+				patterns = append(patterns, host)
+				continue
+			}
+			patterns = append(patterns, host, domain, "*."+domain)
+		case ScopeSubdomains:
+			if net.ParseIP(hostname) != nil {
+				patterns = append(patterns, host)
+				continue
+			}
+			patterns = append(patterns, host, hostname, "*."+hostname)
+		default:
+			return nil, fmt.Errorf("unknown scope mode %q, expected %s, %s, %s or %s", mode, ScopeHost, ScopeHostWWW, ScopeDomain, ScopeSubdomains)
+		}
+	}
+	return NewScope(patterns...)
+}
+
+// Scope lets through the links to the hosts it's made of, e.g. the sites of several seeds.
+// a pattern is a host such as "example.com", "docs.example.com:8080" or the url of a page on it, matched exactly
+// (a host without a port is on the default one), or "*.example.com" for any subdomain of example.com
+// on any port but not example.com itself. relative links are in scope.
+type Scope struct {
+	hosts map[string]bool
+	// domains are the ones of the "*." patterns, lowercase with a leading dot
+	domains []string
+}
+
+// NewScope fails on the patterns which can't match any host e.g. "*" or "*.".
+func NewScope(patterns ...string) (*Scope, error) {
+	s := &Scope{hosts: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if err := s.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Scope) add(pattern string) error {
+	host := strings.ToLower(strings.TrimSpace(pattern))
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return fmt.Errorf("invalid scope %q: %w", pattern, err)
+		}
+		host = u.Host
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if domain, isWildcard := strings.CutPrefix(host, "*."); isWildcard {
+		if domain == "" || strings.ContainsAny(domain, "*:") {
+			return fmt.Errorf("invalid scope %q: expected *.domain", pattern)
+		}
+		s.domains = append(s.domains, "."+domain)
+		return nil
+	}
+	if host == "" || strings.Contains(host, "*") {
+		return fmt.Errorf("invalid scope %q: expected a host or *.domain", pattern)
+	}
+	s.hosts[withoutDefaultPort(host)] = true
+	return nil
+}
+
+// withoutDefaultPort drops :80 and :443, which are the same host as without a port.
+func withoutDefaultPort(host string) string {
+	if trimmed, found := strings.CutSuffix(host, ":80"); found {
+		return trimmed
+	}
+	return strings.TrimSuffix(host, ":443")
+}
+
+func (s *Scope) Match(link string) bool {
+	link = strings.Trim(link, " ")
+	// all external links are supposed to have ://, if they don't it must be internal
+	if !strings.Contains(link, "://") {
+		return true
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return s.matchHost(u.Host)
+}
+
+// matchHost tells whether the host, along with its port, is in scope.
+func (s *Scope) matchHost(host string) bool {
+	host = withoutDefaultPort(strings.ToLower(host))
+	if s.hosts[host] {
+		return true
+	}
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+	for _, domain := range s.domains {
+		if strings.HasSuffix(hostname, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// String lists the hosts and "*." patterns of the scope e.g. "scope example.com, *.example.net".
+func (s *Scope) String() string {
+	patterns := make([]string, 0, len(s.hosts)+len(s.domains))
+	for host := range s.hosts {
+		patterns = append(patterns, host)
+	}
+	sort.Strings(patterns)
+	for _, domain := range s.domains {
+		patterns = append(patterns, "*"+domain)
+	}
+	return "scope " + strings.Join(patterns, ", ")
+}
+
+var _ Filter = (*Scope)(nil)
@@ -0,0 +1,78 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope_Match(t *testing.T) {
+	scope, err := NewScope("https://www.example.com/docs", "blog.example.org:8080", "*.example.net")
+	assert.NoError(t, err)
+	tests := []struct {
+		link     string
+		expected bool
+	}{
+		{link: "https://www.example.com/pricing", expected: true},
+		{link: "http://www.example.com", expected: true},
+		{link: "https://WWW.example.com:443/", expected: true},
+		{link: "https://example.com/pricing", expected: false},
+		{link: "https://www.example.com:8443/", expected: false},
+		{link: "https://docs.example.com/", expected: false},
+		{link: "http://blog.example.org:8080/post", expected: true},
+		{link: "http://blog.example.org/post", expected: false},
+		{link: "https://docs.example.net/guide", expected: true},
+		{link: "https://a.b.example.net:8080/", expected: true},
+		{link: "https://example.net/", expected: false},
+		{link: "https://notexample.net/", expected: false},
+		{link: "/relative/path", expected: true},
+		{link: "http://", expected: false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, scope.Match(test.link), test.link)
+	}
+}
+
+func TestNewScope_Invalid(t *testing.T) {
+	for _, pattern := range []string{"", "*", "*.", "*.*.example.com", "docs.*.example.com", "*.example.com:8080"} {
+		_, err := NewScope(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestScopeOf(t *testing.T) {
+	seeds := []string{"https://www.example.co.uk/", "http://docs.example.com:8080/guide", "http://127.0.0.1:9000/"}
+	links := []string{
+		"https://example.co.uk/about",
+		"https://blog.example.co.uk/",
+		"https://other.co.uk/",
+		"http://docs.example.com:8080/",
+		"http://docs.example.com/",
+		"http://api.docs.example.com/",
+		"http://example.com/",
+		"http://127.0.0.1:9000/page",
+		"http://127.0.0.1:9001/page",
+		"https://example.co.uk:443/",
+	}
+	tests := []struct {
+		mode     ScopeMode
+		expected []bool
+	}{
+		{mode: ScopeHost, expected: []bool{false, false, false, true, false, false, false, true, false, false}},
+		{mode: ScopeHostWWW, expected: []bool{true, false, false, true, false, false, false, true, false, true}},
+		{mode: ScopeSubdomains, expected: []bool{true, true, false, true, true, true, false, true, false, true}},
+		{mode: ScopeDomain, expected: []bool{true, true, false, true, true, true, true, true, false, true}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			scope, err := ScopeOf(test.mode, seeds...)
+			assert.NoError(t, err)
+			for i, link := range links {
+				assert.Equal(t, test.expected[i], scope.Match(link), link)
+			}
+		})
+	}
+
+	_, err := ScopeOf("everything", seeds...)
+	assert.EqualError(t, err, `unknown scope mode "everything", expected host, host-www, domain or subdomains`)
+}
@@ -0,0 +1,239 @@
+package crawl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrFrontierClosed = errors.New("frontier is closed")
+
+// Frontier holds the tasks waiting to be crawled, in the order they were pushed.
+// implementations must be safe for concurrent usage and never block on Push.
+// deduplication isn't the frontier's concern, the queues take care of it.
+type Frontier interface {
+	Push(task Task) error
+	// Pop returns the oldest task, false when there's none
+	Pop() (Task, bool)
+	Len() int
+	// Close releases what the frontier holds, the tasks left are dropped
+	Close() error
+}
+
+// MemoryFrontier keeps every task in memory.
+type MemoryFrontier struct {
+	mu     sync.Mutex
+	tasks  []Task
+	head   int
+	closed bool
+}
+
+func NewMemoryFrontier() *MemoryFrontier {
+	return &MemoryFrontier{tasks: make([]Task, 0)}
+}
+
+func (f *MemoryFrontier) Push(task Task) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrFrontierClosed
+	}
+	f.tasks = append(f.tasks, task)
+	return nil
+}
+
+func (f *MemoryFrontier) Pop() (Task, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.head == len(f.tasks) {
+		return Task{}, false
+	}
+	task := f.tasks[f.head]
+	f.tasks[f.head] = Task{}
+	f.head++
+	// drops the popped tasks once they're most of the slice
+	if f.head > 1024 && f.head*2 > len(f.tasks) {
+		f.tasks = append(make([]Task, 0, len(f.tasks)-f.head), f.tasks[f.head:]...)
+		f.head = 0
+	}
+	return task, true
+}
+
+func (f *MemoryFrontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tasks) - f.head
+}
+
+func (f *MemoryFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.tasks = nil
+	f.head = 0
+	return nil
+}
+
+// DiskFrontier keeps at most two segments of tasks in memory, the ones in between are spilled to segment files on disk.
+// tasks are popped from the head segment and pushed to the tail one, once the tail is full it's written to disk.
+type DiskFrontier struct {
+	dir         string
+	segmentSize int
+
+	mu          sync.Mutex
+	head        []Task
+	tail        []Task
+	segments    []string
+	nextSegment int
+	length      int
+	closed      bool
+}
+
+// NewDiskFrontier spills the tasks to a new directory within dir, segmentSize being the amount of tasks per segment file.
+// the directory is removed on Close.
+func NewDiskFrontier(dir string, segmentSize int) (*DiskFrontier, error) {
+	if segmentSize <= 0 {
+		return nil, fmt.Errorf("segment size must be positive, got %d", segmentSize)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	segmentsDir, err := os.MkdirTemp(dir, "frontier-")
+	if err != nil {
+		return nil, err
+	}
+	return &DiskFrontier{
+		dir:         segmentsDir,
+		segmentSize: segmentSize,
+		head:        make([]Task, 0),
+		tail:        make([]Task, 0, segmentSize),
+	}, nil
+}
+
+func (f *DiskFrontier) Push(task Task) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrFrontierClosed
+	}
+	f.tail = append(f.tail, task)
+	f.length++
+	if len(f.tail) < f.segmentSize {
+		return nil
+	}
+	if err := f.spill(); err != nil {
+		// the task isn't queued after all, the caller is told it wasn't
+		f.tail = f.tail[:len(f.tail)-1]
+		f.length--
+		return fmt.Errorf("failed to spill frontier to disk: %w", err)
+	}
+	return nil
+}
+
+func (f *DiskFrontier) Pop() (Task, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.head) == 0 && !f.refill() {
+		return Task{}, false
+	}
+	task := f.head[0]
+	f.head = f.head[1:]
+	f.length--
+	return task, true
+}
+
+func (f *DiskFrontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.length
+}
+
+func (f *DiskFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.head, f.tail, f.segments = nil, nil, nil
+	f.length = 0
+	return os.RemoveAll(f.dir)
+}
+
+// spill writes the tail to a new segment file. f.mu must be held.
+func (f *DiskFrontier) spill() error {
+	path := filepath.Join(f.dir, fmt.Sprintf("%08d.jsonl", f.nextSegment))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, task := range f.tail {
+		if err := encoder.Encode(task); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	f.nextSegment++
+	f.segments = append(f.segments, path)
+	f.tail = make([]Task, 0, f.segmentSize)
+	return nil
+}
+
+// refill moves the oldest tasks into the head, returning false when there's none. f.mu must be held.
+func (f *DiskFrontier) refill() bool {
+	for len(f.segments) > 0 {
+		path := f.segments[0]
+		f.segments = f.segments[1:]
+		tasks, err := readSegment(path)
+		_ = os.Remove(path)
+		if err != nil {
+			// the tasks of the segment are lost, the crawl goes on without them
+			log.Printf("[Error] failed to read frontier segment %s: %s\n", path, err)
+			f.length -= f.segmentSize - len(tasks)
+		}
+		if len(tasks) > 0 {
+			f.head = tasks
+			return true
+		}
+	}
+	if len(f.tail) == 0 {
+		return false
+	}
+	f.head = f.tail
+	f.tail = make([]Task, 0, f.segmentSize)
+	return true
+}
+
+func readSegment(path string) ([]Task, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	tasks := make([]Task, 0)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var task Task
+		if err := decoder.Decode(&task); err != nil {
+			return tasks, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+var (
+	_ Frontier = (*MemoryFrontier)(nil)
+	_ Frontier = (*DiskFrontier)(nil)
+)
@@ -0,0 +1,96 @@
+package crawl
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontier_KeepsOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		newFrontier func(t *testing.T) Frontier
+	}{
+		{
+			name:        "memory",
+			newFrontier: func(t *testing.T) Frontier { return NewMemoryFrontier() },
+		},
+		{
+			name: "disk",
+			newFrontier: func(t *testing.T) Frontier {
+				frontier, err := NewDiskFrontier(t.TempDir(), 3)
+				assert.NoError(t, err)
+				return frontier
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frontier := test.newFrontier(t)
+			defer frontier.Close()
+
+			_, ok := frontier.Pop()
+			assert.False(t, ok)
+
+			// pops in between pushes, going over a few segments
+			for i := 0; i < 5; i++ {
+				assert.NoError(t, frontier.Push(Task{URL: fmt.Sprint(i), Depth: i}))
+			}
+			first, _ := frontier.Pop()
+			assert.Equal(t, Task{URL: "0", Depth: 0}, first)
+			for i := 5; i < 11; i++ {
+				assert.NoError(t, frontier.Push(Task{URL: fmt.Sprint(i), Depth: i}))
+			}
+			assert.Equal(t, 10, frontier.Len())
+
+			for i := 1; i < 11; i++ {
+				task, ok := frontier.Pop()
+				assert.True(t, ok)
+				assert.Equal(t, Task{URL: fmt.Sprint(i), Depth: i}, task)
+			}
+			_, ok = frontier.Pop()
+			assert.False(t, ok)
+			assert.Equal(t, 0, frontier.Len())
+
+			assert.NoError(t, frontier.Close())
+			assert.ErrorIs(t, frontier.Push(Task{URL: "closed"}), ErrFrontierClosed)
+		})
+	}
+}
+
+func TestDiskFrontier_SpillsToDisk(t *testing.T) {
+	frontier, err := NewDiskFrontier(t.TempDir(), 2)
+	assert.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, frontier.Push(Task{URL: fmt.Sprint(i)}))
+	}
+	segments, err := os.ReadDir(frontier.dir)
+	assert.NoError(t, err)
+	assert.Len(t, segments, 3)
+	assert.Len(t, frontier.tail, 1)
+
+	assert.NoError(t, frontier.Close())
+	_, err = os.Stat(frontier.dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiskFrontier_FailedSpill(t *testing.T) {
+	frontier, err := NewDiskFrontier(t.TempDir(), 2)
+	assert.NoError(t, err)
+	defer frontier.Close()
+	assert.NoError(t, frontier.Push(Task{URL: "0"}))
+	// segments can't be written anymore
+	assert.NoError(t, os.RemoveAll(frontier.dir))
+
+	assert.Error(t, frontier.Push(Task{URL: "1"}))
+	assert.Equal(t, 1, frontier.Len())
+	task, ok := frontier.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "0", task.URL)
+	_, ok = frontier.Pop()
+	assert.False(t, ok, "the task which failed to be pushed mustn't be popped")
+}
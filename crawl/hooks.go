@@ -0,0 +1,22 @@
+package crawl
+
+import "spiderman/crawl/links"
+
+// Hooks are called as the crawl goes, from every worker at once with CrawlParallel so they must be safe for concurrent use.
+// the hooks which aren't set are skipped.
+type Hooks struct {
+	// BeforeFetch is called before a url is fetched for the first time, returning false skips the url
+	BeforeFetch func(task Task) bool
+	// AfterFetch is called after every attempt at fetching a page, err being why the attempt failed if it did
+	AfterFetch func(task Task, page *links.Page, err error)
+}
+
+func (h Hooks) beforeFetch(task Task) bool {
+	return h.BeforeFetch == nil || h.BeforeFetch(task)
+}
+
+func (h Hooks) afterFetch(task Task, page *links.Page, err error) {
+	if h.AfterFetch != nil {
+		h.AfterFetch(task, page, err)
+	}
+}
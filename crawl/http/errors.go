@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// the errors a fetch fails with, telling the failures apart with errors.As.
+// the ones coming from the network wrap the original error.
+
+// StatusError is returned when the server responds with a status which can't be crawled.
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the wait asked for by the `Retry-After` header, 0 when missing.
+	RetryAfter time.Duration
+	message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.message
+}
+
+// TimeoutError is returned when the server took too long to respond, or to send the body.
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return "timed out: " + e.Err.Error() }
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// DNSError is returned when the host couldn't be resolved.
+type DNSError struct {
+	Host string
+	// Temporary is whether the resolver might succeed later on, unlike for a host which doesn't exist
+	Temporary bool
+	Err       error
+}
+
+func (e *DNSError) Error() string { return fmt.Sprintf("failed to resolve %s: %s", e.Host, e.Err) }
+func (e *DNSError) Unwrap() error { return e.Err }
+
+// ConnectionError is returned when the connection was refused, or lost before the response was complete.
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string { return "connection failed: " + e.Err.Error() }
+func (e *ConnectionError) Unwrap() error { return e.Err }
+
+// TLSError is returned when the TLS handshake failed e.g. the certificate is expired or for another host.
+type TLSError struct {
+	Err error
+}
+
+func (e *TLSError) Error() string { return "tls failed: " + e.Err.Error() }
+func (e *TLSError) Unwrap() error { return e.Err }
+
+// TooLargeError is returned when the body is bigger than the fetcher's MaxBodySize.
+type TooLargeError struct {
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string { return fmt.Sprintf("body is bigger than %d bytes", e.Limit) }
+
+// ParseError is returned when the url or the response couldn't be parsed.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string { return "failed to parse: " + e.Err.Error() }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// typedError turns an error of the http client, or of reading the body, into one of the errors above.
+// errors which don't fit any are returned as is.
+func typedError(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the crawl is stopping, it's not the page's fault
+		return err
+	case errors.As(err, &dnsErr) && !dnsErr.IsTimeout:
+		return &DNSError{Host: dnsErr.Name, Temporary: dnsErr.IsTemporary, Err: err}
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return &TimeoutError{Err: err}
+	case errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &invalidCert):
+		return &TLSError{Err: err}
+	case errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		return &ConnectionError{Err: err}
+	}
+	return err
+}
+
+// checkedBody is the body of a response which fails with a TooLargeError past the limit,
+// the errors of reading it are turned into the ones above.
+type checkedBody struct {
+	body io.ReadCloser
+	// limit is the most bytes which can be read, 0 for no limit
+	limit int64
+	read  int64
+}
+
+func (b *checkedBody) Read(p []byte) (int, error) {
+	if b.limit > 0 && int64(len(p)) > b.limit-b.read {
+		// a byte more than the limit tells whether the body goes over it
+		p = p[:b.limit-b.read+1]
+	}
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.limit > 0 && b.read > b.limit {
+		return n - int(b.read-b.limit), &TooLargeError{Limit: b.limit}
+	}
+	if err != nil && err != io.EOF {
+		err = typedError(err)
+	}
+	return n, err
+}
+
+func (b *checkedBody) Close() error {
+	return b.body.Close()
+}
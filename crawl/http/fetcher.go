@@ -1,80 +1,233 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrRedirectLoop     = errors.New("redirect loop")
+	// ErrRedirectRejected is when the redirect check of the context rejected where a redirect goes, see WithRedirectCheck
+	ErrRedirectRejected = errors.New("redirect target rejected")
+)
+
+type redirectCheckKey struct{}
+
+// WithRedirectCheck makes the fetches made with the context stop before requesting a redirect target check rejects,
+// e.g. one out of the scope of a crawl or disallowed by robots.txt. the result then has the target as its URL,
+// no status since it wasn't requested, and ErrRedirectRejected.
+// it's the context rather than the Fetcher which carries it since a Fetcher is shared by requests which don't need it.
+func WithRedirectCheck(ctx context.Context, check func(next string) bool) context.Context {
+	return context.WithValue(ctx, redirectCheckKey{}, check)
+}
+
 type FetchResult struct {
+	// URL is where the request ended up after following redirects
+	URL         string
+	StatusCode  int
+	ContentType string
+	// Header is the header of the last response, nil when none was received
+	Header http.Header
+	Body   io.ReadCloser // caller must close Body if non-nil
+	// Redirects are the hops which were followed to get to URL, in order
+	Redirects []Redirect
+	Err       error
+}
+
+// Redirect is a single hop of a redirect chain.
+type Redirect struct {
+	URL        string
 	StatusCode int
-	Body       io.ReadCloser // caller must close Body if non-nil
-	Location   string        // redirect target URL if applicable
-	Err        error
 }
 
 type Fetcher struct {
 	Client *http.Client
+	// Retry is used by FetchWithRetry
+	Retry RetryPolicy
+	// MaxRedirects is the amount of redirects followed before giving up
+	MaxRedirects int
+	// MaxBodySize is the most bytes read from a body before failing with a TooLargeError, 0 for no limit
+	MaxBodySize int64
+	// UserAgent is sent with every request, none when empty
+	UserAgent string
 }
 
+// DefaultUserAgent mimics chrome so some sites don't answer with `202` instead of the page.
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36"
+
 func NewFetcher() *Fetcher {
 	return &Fetcher{
 		Client: &http.Client{
 			Timeout: 30 * time.Second,
+			// redirects are followed by Fetch itself to keep track of the chain
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
 		},
+		Retry:        DefaultRetryPolicy(),
+		MaxRedirects: 10,
+		UserAgent:    DefaultUserAgent,
 	}
 }
 
 // Fetch makes a GET request for the given URL and returns a FetchResult.
+// Redirects are followed up to MaxRedirects, the hops are returned in FetchResult.Redirects
 // This version does NOT perform retries; it returns immediately with what it gets
-// http call from fetch tries to mimic chrome browser to not get `202` status code in some cases.
-//
-// ## improvements
-// - retrying is left out atm to not block threads.
+// Callers which can't afford to wait should schedule the retries themselves using Retry.Backoff
 func (f *Fetcher) Fetch(rawUrl string) FetchResult {
-	req, err := http.NewRequest("GET", rawUrl, nil)
+	return f.FetchContext(context.Background(), rawUrl)
+}
+
+// FetchContext is Fetch which gets aborted, including reading the body, once the context is done.
+func (f *Fetcher) FetchContext(ctx context.Context, rawUrl string) FetchResult {
+	return f.follow(ctx, http.MethodGet, rawUrl)
+}
+
+// HeadContext is FetchContext making HEAD requests, the result never has a Body.
+func (f *Fetcher) HeadContext(ctx context.Context, rawUrl string) FetchResult {
+	return f.follow(ctx, http.MethodHead, rawUrl)
+}
+
+// follow makes the request, following the redirects.
+func (f *Fetcher) follow(ctx context.Context, method string, rawUrl string) FetchResult {
+	var redirects []Redirect
+	seen := map[string]bool{rawUrl: true}
+	current := rawUrl
+	for {
+		result, location := f.fetchOnce(ctx, method, current)
+		result.URL = current
+		result.Redirects = redirects
+		if location == "" {
+			return result
+		}
+		redirects = append(redirects, Redirect{URL: current, StatusCode: result.StatusCode})
+		result.Redirects = redirects
+
+		next, err := resolveLocation(current, location)
+		switch {
+		case err != nil:
+			result.Err = &ParseError{Err: fmt.Errorf("invalid redirect location %q: %w", location, err)}
+		case len(redirects) > f.MaxRedirects:
+			result.Err = fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, f.MaxRedirects)
+		case seen[next]:
+			result.Err = fmt.Errorf("%w: %s was already visited", ErrRedirectLoop, next)
+		case !redirectAllowed(ctx, next):
+			result.URL, result.StatusCode = next, 0
+			result.Err = fmt.Errorf("%w: %s", ErrRedirectRejected, next)
+		}
+		if result.Err != nil {
+			return result
+		}
+		seen[next] = true
+		current = next
+	}
+}
+
+// redirectAllowed tells whether the redirect check of the context, if any, lets the target be requested.
+func redirectAllowed(ctx context.Context, next string) bool {
+	check, ok := ctx.Value(redirectCheckKey{}).(func(next string) bool)
+	return !ok || check(next)
+}
+
+// fetchOnce makes a single request, returning the Location to follow in case of a redirect.
+func (f *Fetcher) fetchOnce(ctx context.Context, method string, rawUrl string) (FetchResult, string) {
+	req, err := http.NewRequestWithContext(ctx, method, rawUrl, nil)
 	if err != nil {
-		return FetchResult{Err: err}
+		return FetchResult{Err: &ParseError{Err: err}}, ""
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
 	}
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36") // Or mimic your version
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := f.Client.Do(req)
 	if err != nil {
-		return FetchResult{Err: err}
+		return FetchResult{Err: typedError(err)}, ""
 	}
 
 	switch resp.StatusCode {
 	case http.StatusOK, 201, 203, 204, 206:
-		return FetchResult{
-			StatusCode: resp.StatusCode,
-			Body:       resp.Body,
-			Err:        nil,
+		result := FetchResult{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Header:      resp.Header,
+		}
+		if method == http.MethodHead {
+			resp.Body.Close()
+			return result, ""
 		}
+		if f.MaxBodySize > 0 && resp.ContentLength > f.MaxBodySize {
+			// no need to download what's going to be given up on
+			resp.Body.Close()
+			result.Err = &TooLargeError{Limit: f.MaxBodySize}
+			return result, ""
+		}
+		result.Body = &checkedBody{body: resp.Body, limit: f.MaxBodySize}
+		return result, ""
 	case 301, 302, 303, 307, 308:
 		location := resp.Header.Get("Location")
 		resp.Body.Close()
 		if location == "" {
 			return FetchResult{
 				StatusCode: resp.StatusCode,
-				Err:        fmt.Errorf("redirect status %d without Location header", resp.StatusCode),
-			}
+				Err: &StatusError{
+					StatusCode: resp.StatusCode,
+					message:    fmt.Sprintf("redirect status %d without Location header", resp.StatusCode),
+				},
+			}, ""
 		}
 		return FetchResult{
 			StatusCode: resp.StatusCode,
-			Location:   location,
 			Err:        nil,
-		}
+		}, location
+	}
+	statusErr := &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	switch resp.StatusCode {
 	case 202:
-		err = errors.New("received HTTP 202 Accepted - processing not complete")
+		statusErr.message = "received HTTP 202 Accepted - processing not complete"
 	case 429:
-		err = errors.New("received HTTP 429 Too Many Requests")
+		statusErr.message = "received HTTP 429 Too Many Requests"
 	default:
-		err = errors.New(fmt.Sprintf("failed with status %d", resp.StatusCode))
+		statusErr.message = fmt.Sprintf("failed with status %d", resp.StatusCode)
 	}
 	resp.Body.Close()
 	return FetchResult{
-		StatusCode: resp.StatusCode,
-		Err:        err,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+		Err:         statusErr,
+	}, ""
+}
+
+// resolveLocation resolves the Location header relative to the url which was requested.
+func resolveLocation(requestUrl, location string) (string, error) {
+	base, err := url.Parse(requestUrl)
+	if err != nil {
+		return "", err
 	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// FetchWithRetry is Fetch which sleeps between attempts according to the Retry policy,
+// meant for the one-off requests where blocking is fine e.g. robots.txt
+func (f *Fetcher) FetchWithRetry(rawUrl string) FetchResult {
+	return f.FetchWithRetryContext(context.Background(), rawUrl)
+}
+
+// FetchWithRetryContext is FetchWithRetry which gives up, waiting included, once the context is done.
+func (f *Fetcher) FetchWithRetryContext(ctx context.Context, rawUrl string) FetchResult {
+	return f.Retry.Do(ctx, func(ctx context.Context) FetchResult {
+		return f.FetchContext(ctx, rawUrl)
+	})
 }
@@ -0,0 +1,202 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/moved/", func(w http.ResponseWriter, r *http.Request) {
+		// relative to the request url
+		http.Redirect(w, r, "../new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("new"))
+	})
+	mux.HandleFunc("/loop-a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-b", http.StatusFound)
+	})
+	mux.HandleFunc("/loop-b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-a", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetcher_FollowsRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+
+	result := NewFetcher().Fetch(server.URL + "/old")
+	assert.NoError(t, result.Err)
+	defer result.Body.Close()
+	assert.Equal(t, server.URL+"/new", result.URL)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, []Redirect{
+		{URL: server.URL + "/old", StatusCode: http.StatusMovedPermanently},
+		{URL: server.URL + "/moved/", StatusCode: http.StatusFound},
+	}, result.Redirects)
+}
+
+func TestFetcher_NoRedirect(t *testing.T) {
+	server := newRedirectServer(t)
+
+	result := NewFetcher().Fetch(server.URL + "/new")
+	assert.NoError(t, result.Err)
+	defer result.Body.Close()
+	assert.Equal(t, server.URL+"/new", result.URL)
+	assert.Empty(t, result.Redirects)
+}
+
+func TestFetcher_RedirectLoop(t *testing.T) {
+	server := newRedirectServer(t)
+
+	result := NewFetcher().Fetch(server.URL + "/loop-a")
+	assert.ErrorIs(t, result.Err, ErrRedirectLoop)
+	assert.Len(t, result.Redirects, 2)
+}
+
+func TestFetcher_TooManyRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+
+	fetcher := NewFetcher()
+	fetcher.MaxRedirects = 1
+	result := fetcher.Fetch(server.URL + "/old")
+	assert.ErrorIs(t, result.Err, ErrTooManyRedirects)
+	assert.Len(t, result.Redirects, 2)
+}
+
+func TestFetcher_RedirectCheck(t *testing.T) {
+	server := newRedirectServer(t)
+
+	checked := make([]string, 0)
+	ctx := WithRedirectCheck(context.Background(), func(next string) bool {
+		checked = append(checked, next)
+		return next != server.URL+"/new"
+	})
+	result := NewFetcher().FetchContext(ctx, server.URL+"/old")
+	assert.ErrorIs(t, result.Err, ErrRedirectRejected)
+	assert.Nil(t, result.Body)
+	assert.Equal(t, server.URL+"/new", result.URL)
+	assert.Zero(t, result.StatusCode)
+	assert.Equal(t, []Redirect{
+		{URL: server.URL + "/old", StatusCode: http.StatusMovedPermanently},
+		{URL: server.URL + "/moved/", StatusCode: http.StatusFound},
+	}, result.Redirects)
+	assert.Equal(t, []string{server.URL + "/moved/", server.URL + "/new"}, checked)
+}
+
+func TestFetcher_TypedErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 100))
+	})
+	mux.HandleFunc("/big-chunked", func(w http.ResponseWriter, r *http.Request) {
+		// flushing before the end leaves out the Content-Length
+		_, _ = w.Write(make([]byte, 10))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(make([]byte, 90))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	tlsServer := httptest.NewTLSServer(mux)
+	t.Cleanup(tlsServer.Close)
+	closed := httptest.NewServer(mux)
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		timeout time.Duration
+		target  any
+		check   func(t *testing.T, target any)
+		message string
+	}{
+		{
+			name:   "status",
+			url:    server.URL + "/gone",
+			target: new(*StatusError),
+			check: func(t *testing.T, target any) {
+				assert.Equal(t, http.StatusGone, (*target.(**StatusError)).StatusCode)
+			},
+		},
+		// only this one gets a short timeout, the others could time out under load otherwise
+		{name: "timeout", url: server.URL + "/slow", timeout: 50 * time.Millisecond, target: new(*TimeoutError)},
+		{name: "connection refused", url: closed.URL, target: new(*ConnectionError)},
+		{name: "tls", url: tlsServer.URL + "/gone", target: new(*TLSError)},
+		{
+			name:   "too large",
+			url:    server.URL + "/big",
+			target: new(*TooLargeError),
+			check: func(t *testing.T, target any) {
+				assert.Equal(t, int64(50), (*target.(**TooLargeError)).Limit)
+			},
+		},
+		{name: "too large without content length", url: server.URL + "/big-chunked", target: new(*TooLargeError)},
+		{name: "parse", url: "http://exa mple.com/", target: new(*ParseError)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := NewFetcher()
+			if test.timeout > 0 {
+				fetcher.Client.Timeout = test.timeout
+			}
+			fetcher.MaxBodySize = 50
+
+			result := fetcher.Fetch(test.url)
+			err := result.Err
+			if err == nil {
+				// the body is only found to be too large once it's read
+				_, err = io.ReadAll(result.Body)
+				_ = result.Body.Close()
+			}
+			if assert.ErrorAs(t, err, test.target) && test.check != nil {
+				test.check(t, test.target)
+			}
+		})
+	}
+}
+
+func TestTypedError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target any
+	}{
+		{name: "dns", err: &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "nope.invalid", IsNotFound: true}}}, target: new(*DNSError)},
+		{name: "dns timeout", err: &net.DNSError{Name: "slow.example", IsTimeout: true}, target: new(*TimeoutError)},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, target: new(*ConnectionError)},
+		{name: "deadline", err: context.DeadlineExceeded, target: new(*TimeoutError)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			typed := typedError(test.err)
+			assert.ErrorAs(t, typed, test.target)
+			assert.ErrorIs(t, typed, test.err, "the original error is wrapped")
+		})
+	}
+
+	assert.Equal(t, context.Canceled, typedError(context.Canceled))
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewFileFetcher fetches the files under root as if they were the site, whatever the host of the url,
+// e.g. to crawl a static site which was built locally. directories are served with their index.html.
+func NewFileFetcher(root string) *Fetcher {
+	fetcher := NewFetcher()
+	fetcher.Client.Transport = http.NewFileTransport(http.Dir(root))
+	return fetcher
+}
+
+// Fixture is a recorded response.
+type Fixture struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// NewFixtureFetcher answers with the fixture recorded for the url, 404 for the urls which weren't recorded.
+func NewFixtureFetcher(fixtures []Fixture) *Fetcher {
+	fetcher := NewFetcher()
+	fetcher.Client.Transport = newFixtureTransport(fixtures)
+	return fetcher
+}
+
+// LoadFixtures reads the fixtures written by a RecordingTransport, a JSON object per line.
+func LoadFixtures(r io.Reader) ([]Fixture, error) {
+	fixtures := make([]Fixture, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(scanner.Bytes(), &fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture on line %d: %w", line, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, scanner.Err()
+}
+
+// fixtureTransport answers the requests with the fixtures, the last one recorded for a url wins.
+type fixtureTransport struct {
+	fixtures map[string]Fixture
+}
+
+func newFixtureTransport(fixtures []Fixture) *fixtureTransport {
+	t := &fixtureTransport{fixtures: make(map[string]Fixture, len(fixtures))}
+	for _, fixture := range fixtures {
+		t.fixtures[fixture.URL] = fixture
+	}
+	return t
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fixture, recorded := t.fixtures[req.URL.String()]
+	if !recorded {
+		fixture = Fixture{StatusCode: http.StatusNotFound}
+	}
+	header := fixture.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	body := fixture.Body
+	if req.Method == http.MethodHead {
+		body = ""
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.StatusCode, http.StatusText(fixture.StatusCode)),
+		StatusCode:    fixture.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// RecordingTransport records every response it gets from Next to a GET as a Fixture, a JSON object per line,
+// for NewFixtureFetcher to answer with later on. it's safe for concurrent use.
+type RecordingTransport struct {
+	// Next makes the requests, http.DefaultTransport when nil
+	Next http.RoundTripper
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewRecordingTransport(next http.RoundTripper, w io.Writer) *RecordingTransport {
+	return &RecordingTransport{Next: next, encoder: json.NewEncoder(w)}
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet {
+		// a HEAD would replace the body of the GET with nothing
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = t.encoder.Encode(Fixture{URL: req.URL.String(), StatusCode: resp.StatusCode, Header: resp.Header, Body: string(body)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+var (
+	_ http.RoundTripper = (*fixtureTransport)(nil)
+	_ http.RoundTripper = (*RecordingTransport)(nil)
+)
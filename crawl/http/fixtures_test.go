@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFetcher(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "docs"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte(`<a href="/docs">Docs</a>`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "docs", "index.html"), []byte(`<h1>Docs</h1>`), 0o644))
+
+	fetcher := NewFileFetcher(root)
+	tests := []struct {
+		name           string
+		url            string
+		expectedURL    string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "root", url: "http://example.com/", expectedURL: "http://example.com/", expectedStatus: http.StatusOK, expectedBody: `<a href="/docs">Docs</a>`},
+		{name: "directory", url: "https://other.example.com/docs", expectedURL: "https://other.example.com/docs/", expectedStatus: http.StatusOK, expectedBody: `<h1>Docs</h1>`},
+		{name: "missing", url: "http://example.com/missing.html", expectedURL: "http://example.com/missing.html", expectedStatus: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := fetcher.FetchContext(context.Background(), test.url)
+			assert.Equal(t, test.expectedURL, result.URL)
+			assert.Equal(t, test.expectedStatus, result.StatusCode)
+			if test.expectedBody == "" {
+				assert.Nil(t, result.Body)
+				return
+			}
+			assert.NoError(t, result.Err)
+			assert.Equal(t, "text/html; charset=utf-8", result.ContentType)
+			body, _ := io.ReadAll(result.Body)
+			_ = result.Body.Close()
+			assert.Equal(t, test.expectedBody, string(body))
+		})
+	}
+}
+
+func TestFixtureFetcher(t *testing.T) {
+	fetcher := NewFixtureFetcher([]Fixture{
+		{URL: "http://example.com/old", StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"/new"}}},
+		{URL: "http://example.com/new", StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/html"}}, Body: "new page"},
+	})
+
+	result := fetcher.FetchContext(context.Background(), "http://example.com/old")
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "http://example.com/new", result.URL)
+	assert.Equal(t, []Redirect{{URL: "http://example.com/old", StatusCode: http.StatusMovedPermanently}}, result.Redirects)
+	assert.Equal(t, "text/html", result.ContentType)
+	body, _ := io.ReadAll(result.Body)
+	_ = result.Body.Close()
+	assert.Equal(t, "new page", string(body))
+
+	head := fetcher.HeadContext(context.Background(), "http://example.com/new")
+	assert.NoError(t, head.Err)
+	assert.Nil(t, head.Body)
+
+	missing := fetcher.FetchContext(context.Background(), "http://example.com/missing")
+	var statusErr *StatusError
+	assert.True(t, errors.As(missing.Err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestRecordingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("recorded " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	var recorded bytes.Buffer
+	recorder := NewFetcher()
+	recorder.Client.Transport = NewRecordingTransport(nil, &recorded)
+	live := recorder.FetchContext(context.Background(), server.URL+"/old")
+	assert.NoError(t, live.Err)
+	_ = live.Body.Close()
+	// a HEAD isn't recorded over the GET
+	assert.NoError(t, recorder.HeadContext(context.Background(), server.URL+"/new").Err)
+
+	fixtures, err := LoadFixtures(&recorded)
+	assert.NoError(t, err)
+	assert.Len(t, fixtures, 2)
+	replayed := NewFixtureFetcher(fixtures).FetchContext(context.Background(), server.URL+"/old")
+	assert.NoError(t, replayed.Err)
+	assert.Equal(t, live.URL, replayed.URL)
+	assert.Equal(t, live.Redirects, replayed.Redirects)
+	body, _ := io.ReadAll(replayed.Body)
+	_ = replayed.Body.Close()
+	assert.Equal(t, "recorded /new", string(body))
+}
+
+func TestLoadFixtures_Invalid(t *testing.T) {
+	_, err := LoadFixtures(bytes.NewBufferString("{\"url\": \"http://example.com/\", \"status\": 200}\n\nnot json\n"))
+	assert.EqualError(t, err, "invalid fixture on line 3: invalid character 'o' in literal null (expecting 'u')")
+}
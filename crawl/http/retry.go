@@ -0,0 +1,145 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrorClass groups the network errors which are worth retrying.
+type ErrorClass string
+
+const (
+	ErrClassTimeout    ErrorClass = "timeout"
+	ErrClassConnection ErrorClass = "connection"
+	ErrClassDNS        ErrorClass = "dns"
+	ErrClassOther      ErrorClass = "other"
+)
+
+// RetryPolicy decides which failed fetches are attempted again and after how long.
+// it doesn't sleep itself, callers are expected to schedule the next attempt
+// so a worker isn't held up while waiting.
+type RetryPolicy struct {
+	// MaxAttempts including the first one, 1 or less disables retries.
+	MaxAttempts int
+	// BaseBackoff is the wait before the second attempt, doubling with each attempt after.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration
+	// Jitter randomly shortens each wait by up to this fraction [0, 1] so retries don't arrive in bursts.
+	Jitter float64
+	// RetryStatuses are the http statuses which are retried.
+	RetryStatuses []int
+	// RetryErrors are the classes of network errors which are retried.
+	RetryErrors []ErrorClass
+	// HonorRetryAfter waits for the `Retry-After` of a response if it's longer than the backoff.
+	// responses asking for longer than MaxBackoff are not retried.
+	HonorRetryAfter bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		BaseBackoff:     500 * time.Millisecond,
+		MaxBackoff:      30 * time.Second,
+		Jitter:          0.5,
+		RetryStatuses:   []int{http.StatusTooManyRequests, 500, 502, 503, 504},
+		RetryErrors:     []ErrorClass{ErrClassTimeout, ErrClassConnection, ErrClassDNS},
+		HonorRetryAfter: true,
+	}
+}
+
+// NoRetries never retries.
+func NoRetries() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// Backoff tells whether the failed attempt (starting at 1) should be retried and how long to wait for it.
+func (p RetryPolicy) Backoff(attempt int, err error) (time.Duration, bool) {
+	if err == nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	var retryAfter time.Duration
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if !slices.Contains(p.RetryStatuses, statusErr.StatusCode) {
+			return 0, false
+		}
+		retryAfter = statusErr.RetryAfter
+	} else if !slices.Contains(p.RetryErrors, Classify(err)) {
+		return 0, false
+	}
+
+	backoff := p.BaseBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > p.MaxBackoff {
+		// `<=` catches the overflow of the shift
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * min(p.Jitter, 1) * float64(backoff))
+	}
+	if p.HonorRetryAfter && retryAfter > 0 {
+		if retryAfter > p.MaxBackoff {
+			return 0, false
+		}
+		backoff = max(backoff, retryAfter)
+	}
+	return backoff, true
+}
+
+// Do makes attempts with fetch until one doesn't have to be retried, sleeping in between,
+// meant for the one-off requests where blocking is fine e.g. robots.txt.
+// once the context is done the last result is returned, its error joined with the context's.
+func (p RetryPolicy) Do(ctx context.Context, fetch func(ctx context.Context) FetchResult) FetchResult {
+	for attempt := 1; ; attempt++ {
+		result := fetch(ctx)
+		wait, retry := p.Backoff(attempt, result.Err)
+		if !retry {
+			return result
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			result.Err = errors.Join(result.Err, ctx.Err())
+			return result
+		}
+	}
+}
+
+// Classify figures out the class of a network error from the typed error it is, see typedError.
+func Classify(err error) ErrorClass {
+	var timeoutErr *TimeoutError
+	var dnsErr *DNSError
+	var connectionErr *ConnectionError
+	typed := typedError(err)
+	switch {
+	case errors.As(typed, &timeoutErr):
+		return ErrClassTimeout
+	case errors.As(typed, &dnsErr) && dnsErr.Temporary:
+		return ErrClassDNS
+	case errors.As(typed, &connectionErr):
+		return ErrClassConnection
+	}
+	// e.g. a host which doesn't exist, no point retrying it
+	return ErrClassOther
+}
+
+// parseRetryAfter reads the `Retry-After` header which is either seconds or an http date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:     3,
+		BaseBackoff:     100 * time.Millisecond,
+		MaxBackoff:      time.Second,
+		RetryStatuses:   []int{429, 503},
+		RetryErrors:     []ErrorClass{ErrClassTimeout, ErrClassConnection},
+		HonorRetryAfter: true,
+	}
+
+	tests := []struct {
+		name          string
+		attempt       int
+		err           error
+		expectedWait  time.Duration
+		expectedRetry bool
+	}{
+		{
+			name:          "retryable status",
+			attempt:       1,
+			err:           &StatusError{StatusCode: 503},
+			expectedWait:  100 * time.Millisecond,
+			expectedRetry: true,
+		},
+		{
+			name:          "backoff doubles",
+			attempt:       2,
+			err:           &StatusError{StatusCode: 503},
+			expectedWait:  200 * time.Millisecond,
+			expectedRetry: true,
+		},
+		{
+			name:    "attempts exhausted",
+			attempt: 3,
+			err:     &StatusError{StatusCode: 503},
+		},
+		{
+			name:    "status which isn't retryable",
+			attempt: 1,
+			err:     &StatusError{StatusCode: 404},
+		},
+		{
+			name:          "retry after longer than backoff",
+			attempt:       1,
+			err:           &StatusError{StatusCode: 429, RetryAfter: 500 * time.Millisecond},
+			expectedWait:  500 * time.Millisecond,
+			expectedRetry: true,
+		},
+		{
+			name:    "retry after longer than max backoff",
+			attempt: 1,
+			err:     &StatusError{StatusCode: 429, RetryAfter: time.Minute},
+		},
+		{
+			name:          "wrapped connection error",
+			attempt:       1,
+			err:           fmt.Errorf("get: %w", syscall.ECONNRESET),
+			expectedWait:  100 * time.Millisecond,
+			expectedRetry: true,
+		},
+		{
+			name:    "dns error for a missing host",
+			attempt: 1,
+			err:     &net.DNSError{Err: "no such host", IsNotFound: true},
+		},
+		{
+			name:    "unknown error",
+			attempt: 1,
+			err:     errors.New("boom"),
+		},
+		{
+			name:    "no error",
+			attempt: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, retry := policy.Backoff(tt.attempt, tt.err)
+			assert.Equal(t, tt.expectedRetry, retry)
+			assert.Equal(t, tt.expectedWait, wait)
+		})
+	}
+}
+
+func TestRetryPolicy_BackoffCapsAndJitters(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:   100,
+		BaseBackoff:   time.Second,
+		MaxBackoff:    10 * time.Second,
+		Jitter:        0.5,
+		RetryStatuses: []int{500},
+	}
+	for attempt := 1; attempt < 80; attempt++ {
+		wait, retry := policy.Backoff(attempt, &StatusError{StatusCode: 500})
+		assert.True(t, retry)
+		assert.LessOrEqual(t, wait, 10*time.Second)
+		assert.GreaterOrEqual(t, wait, min(time.Second<<(attempt-1), 10*time.Second)/2)
+	}
+}
+
+func TestFetcher_FetchWithRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	fetcher.Retry.BaseBackoff = time.Millisecond
+	result := fetcher.FetchWithRetry(server.URL)
+	assert.NoError(t, result.Err)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, 3, requests)
+	result.Body.Close()
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	inAMinute := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, time.Minute, parseRetryAfter(inAMinute), float64(2*time.Second))
+}
+
+func TestRetryPolicy_Do_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	policy := DefaultRetryPolicy()
+	policy.BaseBackoff = time.Hour
+	policy.MaxBackoff = time.Hour
+	result := policy.Do(ctx, func(context.Context) FetchResult {
+		attempts++
+		cancel()
+		return FetchResult{StatusCode: http.StatusServiceUnavailable, Err: &StatusError{StatusCode: http.StatusServiceUnavailable}}
+	})
+	assert.Equal(t, 1, attempts)
+	assert.ErrorIs(t, result.Err, context.Canceled)
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ErrorClass
+	}{
+		{name: "raw timeout", err: context.DeadlineExceeded, expected: ErrClassTimeout},
+		{name: "typed timeout", err: &TimeoutError{Err: errors.New("slow")}, expected: ErrClassTimeout},
+		{name: "temporary dns", err: &net.DNSError{Name: "example.com", IsTemporary: true}, expected: ErrClassDNS},
+		{name: "typed temporary dns", err: typedError(&net.DNSError{Name: "example.com", IsTemporary: true}), expected: ErrClassDNS},
+		{name: "missing host", err: typedError(&net.DNSError{Name: "nope.invalid", IsNotFound: true}), expected: ErrClassOther},
+		{name: "typed connection", err: &ConnectionError{Err: syscall.ECONNREFUSED}, expected: ErrClassConnection},
+		{name: "tls", err: &TLSError{Err: errors.New("bad certificate")}, expected: ErrClassOther},
+		{name: "status", err: &StatusError{StatusCode: 503}, expected: ErrClassOther},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Classify(test.err), test.name)
+	}
+}
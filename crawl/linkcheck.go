@@ -0,0 +1,350 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spiderman/crawl/http"
+	"spiderman/crawl/links"
+	"spiderman/publish"
+)
+
+// DefaultCheckWorkers is the amount of external links checked at once when none is given
+const DefaultCheckWorkers = 8
+
+// BrokenLink is a link target which couldn't be fetched, along with the pages linking to it.
+type BrokenLink struct {
+	URL string `json:"url"`
+	// External is whether the target is outside of the crawled site
+	External bool `json:"external"`
+	// StatusCode is 0 when no response was received
+	StatusCode int             `json:"status,omitempty"`
+	ErrType    publish.ErrType `json:"error_type"`
+	Error      string          `json:"error"`
+	Referrers  []Referrer      `json:"referrers"`
+}
+
+// Referrer is a page linking to a broken link.
+type Referrer struct {
+	URL        string `json:"url"`
+	AnchorText string `json:"anchor_text,omitempty"`
+}
+
+// linkTarget is what's known about a url which was linked to.
+type linkTarget struct {
+	// done is set once the target is known to be fine or broken
+	done   bool
+	broken *BrokenLink
+	// referrers are kept until the target is known to be fine
+	referrers []Referrer
+	// anchors are the ids and names of the elements of a crawled page, nil for the others
+	anchors map[string]bool
+	// fragments are the `#fragment` links to an internal target along with the pages they're on
+	fragments map[string][]Referrer
+}
+
+// LinkChecker is a publisher finding the broken links of a crawl.
+// the internal ones are the pages which failed to be crawled, the external ones are checked once each
+// with a HEAD request, falling back to GET for the servers which don't handle HEAD, while the crawl goes on.
+// the external links are checked by a fixed amount of workers, the hosts being as politely requested as the crawled one,
+// the failed checks are retried once their backoff has passed without holding up a worker meanwhile.
+// `#fragment` links to crawled pages are broken when the page has no element with that id or `<a name>`.
+// the report is ready once PublishStats returned.
+// given to NewCrawler as the publisher, or wrapped in another one along with WithLinkChecker,
+// it makes its requests like the crawler does.
+type LinkChecker struct {
+	ctx        context.Context
+	fetcher    links.Fetcher
+	retry      http.RetryPolicy
+	politeness Politeness
+	// workers is the amount of external links checked at once
+	workers int
+	// queue holds the external links to check until the scheduler has room for them, nil until there's one
+	queue     *TaskQueue
+	scheduler *HostScheduler
+	retries   *retries
+	// checks counts the external links which are queued, being checked or waiting to be retried
+	checks *inFlight
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	targets map[string]*linkTarget
+	// redirected are the urls which redirected, to where they ended up
+	redirected map[string]string
+	report     []BrokenLink
+}
+
+// NewLinkChecker checks up to workers external links at once, the checks are given up on once the context is done.
+func NewLinkChecker(ctx context.Context, workers int) *LinkChecker {
+	if workers <= 0 {
+		workers = DefaultCheckWorkers
+	}
+	return &LinkChecker{
+		ctx:        ctx,
+		fetcher:    http.NewFetcher(),
+		retry:      http.DefaultRetryPolicy(),
+		politeness: DefaultPoliteness(),
+		workers:    workers,
+		retries:    newRetries(),
+		checks:     newInFlight(),
+		targets:    make(map[string]*linkTarget),
+		redirected: make(map[string]string),
+	}
+}
+
+// setUp makes the checks with the fetcher, user agent included, retry policy and politeness of the crawler.
+// it must be called before anything is published.
+func (l *LinkChecker) setUp(fetcher links.Fetcher, retry http.RetryPolicy, politeness Politeness) {
+	l.fetcher = fetcher
+	l.retry = retry
+	l.politeness = politeness
+}
+
+func (l *LinkChecker) Publish(title string, _ []string, meta publish.Meta) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	page := l.resolve(title, nil)
+	page.anchors = make(map[string]bool, len(meta.Anchors))
+	for _, anchor := range meta.Anchors {
+		page.anchors[anchor] = true
+	}
+	onPage := make(map[string]bool, len(meta.Links))
+	for _, link := range meta.Links {
+		target, exists := l.targets[link.URL]
+		if !exists {
+			target = &linkTarget{}
+			l.targets[link.URL] = target
+			if !link.Internal {
+				l.checkExternal(link.URL)
+			}
+		}
+		if link.Internal && checkableFragment(link.Fragment) && !onPage[link.URL+"#"+link.Fragment] {
+			onPage[link.URL+"#"+link.Fragment] = true
+			if target.fragments == nil {
+				target.fragments = make(map[string][]Referrer)
+			}
+			target.fragments[link.Fragment] = append(target.fragments[link.Fragment], Referrer{URL: title, AnchorText: link.AnchorText})
+		}
+		if onPage[link.URL] {
+			continue
+		}
+		onPage[link.URL] = true
+		if target.done && target.broken == nil {
+			continue
+		}
+		target.referrers = append(target.referrers, Referrer{URL: title, AnchorText: link.AnchorText})
+	}
+	return nil
+}
+
+// checkableFragment tells whether the fragment is meant to point to an element of the page.
+// "top" always scrolls to the top, "#/path" and "#!/path" are routes of single page apps,
+// "#:~:text=" highlights text rather than pointing to an element.
+func checkableFragment(fragment string) bool {
+	return fragment != "" && !strings.EqualFold(fragment, "top") &&
+		!strings.HasPrefix(fragment, "/") && !strings.HasPrefix(fragment, "!") && !strings.HasPrefix(fragment, ":~:")
+}
+
+func (l *LinkChecker) RecordError(url string, failedFor publish.ErrType, err error, meta publish.Meta) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	broken := &BrokenLink{URL: url, StatusCode: meta.StatusCode, ErrType: failedFor}
+	if err != nil {
+		broken.Error = err.Error()
+	}
+	target := l.resolve(url, broken)
+	if len(target.referrers) == 0 && meta.Parent != "" {
+		// the page it was found on wasn't published yet
+		target.referrers = append(target.referrers, Referrer{URL: meta.Parent, AnchorText: meta.AnchorText})
+	}
+	return nil
+}
+
+// PublishRedirects keeps track of where the urls ended up, to check the fragments of the links to them.
+func (l *LinkChecker) PublishRedirects(chain []publish.Redirect) error {
+	if len(chain) < 2 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := chain[len(chain)-1].URL
+	for _, hop := range chain[:len(chain)-1] {
+		l.redirected[hop.URL] = last
+	}
+	return nil
+}
+
+// PublishStats waits for the external links to be checked, or the context to be done, then puts the report together.
+func (l *LinkChecker) PublishStats(_ publish.Summary) error {
+	l.checks.done()
+	select {
+	case <-l.checks.idle:
+	case <-l.ctx.Done():
+	}
+	l.mu.Lock()
+	if l.queue != nil {
+		l.queue.Close()
+		l.scheduler.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.report = make([]BrokenLink, 0)
+	for url, target := range l.targets {
+		if target.broken != nil {
+			broken := *target.broken
+			broken.Referrers = sortedReferrers(target.referrers)
+			l.report = append(l.report, broken)
+		}
+		l.report = append(l.report, l.missingAnchors(url, target)...)
+	}
+	sort.Slice(l.report, func(i, j int) bool { return l.report[i].URL < l.report[j].URL })
+	return nil
+}
+
+// Report returns the broken links by url once PublishStats returned.
+func (l *LinkChecker) Report() []BrokenLink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.report
+}
+
+// missingAnchors returns the fragments of the links to the target which don't point to any element. l.mu must be held.
+// nothing is returned when the elements of the page aren't known e.g. it wasn't crawled or failed to be.
+func (l *LinkChecker) missingAnchors(url string, target *linkTarget) []BrokenLink {
+	if len(target.fragments) == 0 {
+		return nil
+	}
+	page := target
+	if final, redirected := l.redirected[url]; redirected {
+		page = l.targets[final]
+	}
+	if page == nil || page.anchors == nil {
+		return nil
+	}
+	var missing []BrokenLink
+	for fragment, referrers := range target.fragments {
+		if page.anchors[fragment] {
+			continue
+		}
+		missing = append(missing, BrokenLink{
+			URL:       url + "#" + fragment,
+			ErrType:   publish.ErrTypeMissingAnchor,
+			Error:     fmt.Sprintf("no element with id or name %q", fragment),
+			Referrers: sortedReferrers(referrers),
+		})
+	}
+	return missing
+}
+
+func sortedReferrers(referrers []Referrer) []Referrer {
+	sort.Slice(referrers, func(i, j int) bool { return referrers[i].URL < referrers[j].URL })
+	return referrers
+}
+
+// resolve records the target as broken, or as fine when broken is nil. l.mu must be held.
+func (l *LinkChecker) resolve(url string, broken *BrokenLink) *linkTarget {
+	target, exists := l.targets[url]
+	if !exists {
+		target = &linkTarget{}
+		l.targets[url] = target
+	}
+	target.done = true
+	target.broken = broken
+	if broken == nil {
+		target.referrers = nil
+	}
+	return target
+}
+
+// checkExternal queues the url to be checked in the background. l.mu must be held.
+func (l *LinkChecker) checkExternal(url string) {
+	if l.queue == nil {
+		l.start()
+	}
+	l.checks.add()
+	l.queue.Add(Task{URL: url})
+}
+
+// start runs the workers, the queue hands the urls over to the scheduler as it has room for them. l.mu must be held.
+func (l *LinkChecker) start() {
+	l.queue = NewTaskQueue()
+	l.scheduler = NewHostScheduler(l.politeness, nil)
+	l.wg.Add(1 + l.workers)
+	go func() {
+		defer l.wg.Done()
+		for task := range l.queue.QueuedTasks() {
+			l.scheduler.Submit(task)
+		}
+	}()
+	for i := 0; i < l.workers; i++ {
+		go func() {
+			defer l.wg.Done()
+			for task := range l.scheduler.Ready() {
+				retryIn, retry := l.checkTask(task)
+				l.scheduler.Done(task)
+				if retry {
+					// still in flight until it's checked again
+					l.scheduler.SubmitAfter(task, retryIn)
+					continue
+				}
+				l.checks.done()
+			}
+		}()
+	}
+}
+
+// checkTask checks the url of the task and records the outcome,
+// unless the check failed and is to be retried after the returned delay.
+func (l *LinkChecker) checkTask(task Task) (time.Duration, bool) {
+	if l.ctx.Err() != nil {
+		return 0, false
+	}
+	attempt := l.retries.take(task.URL)
+	status, err := l.check(task.URL)
+	if l.ctx.Err() != nil {
+		// given up on, it's not known whether it's broken
+		return 0, false
+	}
+	if retryIn, retry := l.retry.Backoff(attempt, err); retry {
+		l.retries.schedule(task.URL, attempt+1)
+		return retryIn, true
+	}
+	var broken *BrokenLink
+	if err != nil {
+		broken = &BrokenLink{URL: task.URL, External: true, StatusCode: status, ErrType: resolveErrType(err), Error: err.Error()}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.resolve(task.URL, broken)
+	return 0, false
+}
+
+// headFetcher is a fetcher which can make HEAD requests, like *http.Fetcher.
+type headFetcher interface {
+	HeadContext(ctx context.Context, url string) http.FetchResult
+}
+
+// check requests the url with HEAD then GET if that failed, GET only when the fetcher can't make HEAD requests.
+// the status is the one of the last response, 0 when there was none.
+func (l *LinkChecker) check(url string) (int, error) {
+	if header, ok := l.fetcher.(headFetcher); ok {
+		result := header.HeadContext(l.ctx, url)
+		if result.Err == nil || l.ctx.Err() != nil {
+			return result.StatusCode, result.Err
+		}
+		// some servers don't handle HEAD, or handle it differently
+	}
+	result := l.fetcher.FetchContext(l.ctx, url)
+	if result.Body != nil {
+		_ = result.Body.Close()
+	}
+	return result.StatusCode, result.Err
+}
+
+var _ publish.Publisher = (*LinkChecker)(nil)
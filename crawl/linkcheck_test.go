@@ -0,0 +1,270 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	crawlhttp "spiderman/crawl/http"
+	"spiderman/publish"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkChecker(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprintf(w, `<a href="/a">A</a> <a href="/b">B</a> <a href="%[1]s/ok">Ok</a> <a href="%[1]s/gone">Gone</a>`, external.URL)
+		case "/a":
+			_, _ = fmt.Fprintf(w, `<a href="/missing">Missing from a</a> <a href="%[1]s/ok">Ok</a> <a href="%[1]s/no-head">No head</a>`, external.URL)
+		case "/b":
+			_, _ = fmt.Fprintf(w, `<a href="/missing">Missing from b</a> <a href="%[1]s/gone">Gone again</a> <a href="%[1]s/gone">Twice</a>`, external.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	checker := NewLinkChecker(context.Background(), 2)
+	err := NewCrawler(site.URL, checker).CrawlParallel(2)
+	assert.NoError(t, err)
+
+	expected := []BrokenLink{
+		{
+			URL:        external.URL + "/gone",
+			External:   true,
+			StatusCode: http.StatusNotFound,
+			ErrType:    publish.ErrTypeNotFound,
+			Error:      "failed with status 404",
+			Referrers: []Referrer{
+				{URL: site.URL + "/", AnchorText: "Gone"},
+				{URL: site.URL + "/b", AnchorText: "Gone again"},
+			},
+		},
+		{
+			URL:        site.URL + "/missing",
+			StatusCode: http.StatusNotFound,
+			ErrType:    publish.ErrTypeNotFound,
+			Error:      "failed with status 404",
+			Referrers: []Referrer{
+				{URL: site.URL + "/a", AnchorText: "Missing from a"},
+				{URL: site.URL + "/b", AnchorText: "Missing from b"},
+			},
+		},
+	}
+	// by url, which depends on the ports of the servers
+	sort.Slice(expected, func(i, j int) bool { return expected[i].URL < expected[j].URL })
+	assert.Equal(t, expected, checker.Report())
+	// every external link is checked once, GET only when HEAD failed
+	assert.Equal(t, map[string]int{
+		"HEAD /ok":      1,
+		"HEAD /no-head": 1,
+		"GET /no-head":  1,
+		"HEAD /gone":    1,
+		"GET /gone":     1,
+	}, requests)
+}
+
+func TestLinkChecker_NothingBroken(t *testing.T) {
+	server := newChainSite(t, 3)
+
+	checker := NewLinkChecker(context.Background(), 0)
+	err := NewCrawler(server.URL, checker).Crawl()
+	assert.NoError(t, err)
+	assert.Empty(t, checker.Report())
+}
+
+func TestLinkChecker_Anchors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<h1 id="top-heading">Home</h1>
+				<a href="#top-heading">Up</a> <a href="#renamed">Gone heading</a> <a href="#top">Top</a> <a href="#/route">Route</a>
+				<a href="/guide#install">Install</a> <a href="/guide#setup">Setup</a> <a href="/old#setup">Old setup</a>
+				<a href="/missing#anything">Missing</a>`)
+		case "/guide":
+			_, _ = fmt.Fprint(w, `<a name="install"></a> <a href="/#renamed">Home heading</a> <a href="/#renamed">Twice</a>`)
+		case "/old":
+			http.Redirect(w, r, "/guide", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	checker := NewLinkChecker(context.Background(), 0)
+	err := NewCrawler(server.URL, checker).Crawl()
+	assert.NoError(t, err)
+
+	missingAnchor := func(url, fragment string, referrers ...Referrer) BrokenLink {
+		return BrokenLink{
+			URL:       url + "#" + fragment,
+			ErrType:   publish.ErrTypeMissingAnchor,
+			Error:     fmt.Sprintf("no element with id or name %q", fragment),
+			Referrers: referrers,
+		}
+	}
+	assert.Equal(t, []BrokenLink{
+		missingAnchor(server.URL+"/", "renamed",
+			Referrer{URL: server.URL + "/", AnchorText: "Gone heading"},
+			Referrer{URL: server.URL + "/guide", AnchorText: "Home heading"},
+		),
+		missingAnchor(server.URL+"/guide", "setup", Referrer{URL: server.URL + "/", AnchorText: "Setup"}),
+		{
+			URL:        server.URL + "/missing",
+			StatusCode: http.StatusNotFound,
+			ErrType:    publish.ErrTypeNotFound,
+			Error:      "failed with status 404",
+			Referrers:  []Referrer{{URL: server.URL + "/", AnchorText: "Missing"}},
+		},
+		missingAnchor(server.URL+"/old", "setup", Referrer{URL: server.URL + "/", AnchorText: "Old setup"}),
+	}, checker.Report())
+}
+
+func TestLinkChecker_WorkersAndPoliteness(t *testing.T) {
+	const links = 40
+	var mu sync.Mutex
+	active, maxActive := make(map[string]int), make(map[string]int)
+	total, maxTotal := 0, 0
+	userAgents := make(map[string]bool)
+	baseline, maxGoroutines := 0, 0
+	newExternal := func() *httptest.Server {
+		server := httptest.NewServer(nil)
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			userAgents[r.UserAgent()] = true
+			active[server.URL]++
+			total++
+			maxActive[server.URL] = max(maxActive[server.URL], active[server.URL])
+			maxTotal = max(maxTotal, total)
+			maxGoroutines = max(maxGoroutines, runtime.NumGoroutine())
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			active[server.URL]--
+			total--
+			mu.Unlock()
+		})
+		t.Cleanup(server.Close)
+		return server
+	}
+	externals := []*httptest.Server{newExternal(), newExternal(), newExternal()}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		for _, external := range externals {
+			for i := 0; i < links; i++ {
+				_, _ = fmt.Fprintf(w, `<a href="%s/%d">%d</a>`, external.URL, i, i)
+			}
+		}
+	}))
+	defer site.Close()
+
+	baseline = runtime.NumGoroutine()
+	checker := NewLinkChecker(context.Background(), 2)
+	err := NewCrawler(site.URL, checker,
+		WithUserAgent("spiderman-test/1.0"),
+		WithPoliteness(Politeness{MaxPerHost: 1}),
+	).Crawl()
+	assert.NoError(t, err)
+
+	assert.Empty(t, checker.Report())
+	// the workers are a fixed amount rather than one per link
+	assert.Less(t, maxGoroutines, baseline+links)
+	assert.LessOrEqual(t, maxTotal, 2)
+	for _, external := range externals {
+		assert.Equal(t, 1, maxActive[external.URL], external.URL)
+	}
+	assert.Equal(t, map[string]bool{"spiderman-test/1.0": true}, userAgents)
+}
+
+func TestLinkChecker_RetriesWithoutHoldingUpWorkers(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	newExternal := func(failures int) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if r.Method == http.MethodGet && failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Method == http.MethodHead && failures > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	flaky, ok := newExternal(1), newExternal(0)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `<a href="%s/flaky">Flaky</a><a href="%s/ok">Ok</a>`, flaky.URL, ok.URL)
+	}))
+	defer site.Close()
+
+	policy := crawlhttp.DefaultRetryPolicy()
+	policy.BaseBackoff = 200 * time.Millisecond
+	policy.Jitter = 0
+	checker := NewLinkChecker(context.Background(), 1)
+	err := NewCrawler(site.URL, checker, WithRetryPolicy(policy)).Crawl()
+	assert.NoError(t, err)
+
+	assert.Empty(t, checker.Report())
+	// the only worker checks the other link while the flaky one waits to be retried
+	assert.Equal(t, []string{"HEAD /flaky", "GET /flaky", "HEAD /ok", "HEAD /flaky"}, requests)
+}
+
+func TestLinkChecker_Wrapped(t *testing.T) {
+	var mu sync.Mutex
+	userAgents := make(map[string]bool)
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		userAgents[r.UserAgent()] = true
+	}))
+	defer external.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="%s/ok">Ok</a>`, external.URL)
+	}))
+	defer site.Close()
+
+	checker := NewLinkChecker(context.Background(), 1)
+	publisher := publish.NewAsyncPublisher(publish.Multi(publish.NewTestPublisher(), checker), publish.AsyncOptions{BufferSize: 8})
+	err := NewCrawler(site.URL, publisher, WithUserAgent("spiderman-test/1.0"), WithLinkChecker(checker)).Crawl()
+	assert.NoError(t, err)
+
+	assert.Empty(t, checker.Report())
+	assert.Equal(t, map[string]bool{"spiderman-test/1.0": true}, userAgents)
+}
@@ -0,0 +1,43 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// findAnchors returns what `#fragment` links can point to on the page: the id of every element and the name of `<a>`,
+// in the order they appear without duplicates.
+func findAnchors(node *html.Node) []string {
+	anchors := make([]string, 0)
+	seen := make(map[string]bool)
+	collectAnchors(node, &anchors, seen)
+	return anchors
+}
+
+func collectAnchors(node *html.Node, anchors *[]string, seen map[string]bool) {
+	if node.Type == html.ElementNode {
+		for _, attr := range node.Attr {
+			if attr.Key != "id" && !(attr.Key == "name" && node.Data == "a") {
+				continue
+			}
+			if attr.Val != "" && !seen[attr.Val] {
+				seen[attr.Val] = true
+				*anchors = append(*anchors, attr.Val)
+			}
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectAnchors(child, anchors, seen)
+	}
+}
+
+// fragment returns the decoded `#fragment` of the href, empty when it has none or it can't be parsed.
+func fragment(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	return u.Fragment
+}
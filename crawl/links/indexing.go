@@ -0,0 +1,64 @@
+package links
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// findCanonical returns the href of the first `<link rel="canonical">`, the others are ignored.
+func findCanonical(node *html.Node) string {
+	if node.Type == html.ElementNode && node.Data == "link" && hasToken(attribute(node, "rel"), "canonical") {
+		if href := attribute(node, "href"); href != "" {
+			return href
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if href := findCanonical(child); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+// metaNoIndex tells whether a `<meta name="robots">` of the page has noindex.
+func metaNoIndex(node *html.Node) bool {
+	if node.Type == html.ElementNode && node.Data == "meta" && strings.EqualFold(attribute(node, "name"), "robots") {
+		if robotsNoIndex([]string{attribute(node, "content")}) {
+			return true
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if metaNoIndex(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsNoIndex tells whether robots directives e.g. "noindex, nofollow" have noindex, or none which implies it.
+// directives aimed at a specific crawler such as "googlebot: noindex" are ignored.
+func robotsNoIndex(values []string) bool {
+	for _, value := range values {
+		if strings.Contains(value, ":") {
+			continue
+		}
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "noindex" || directive == "none" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasToken tells whether the space separated list has the token, ignoring case.
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,29 +1,62 @@
 package links
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
+	nethttp "net/http"
 	"spiderman/crawl/filters"
 	"spiderman/crawl/http"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
 
 type Parser struct {
 	extractors []LinkExtractor
-	fetcher    *http.Fetcher
+	fetcher    Fetcher
 	filters    []filters.Filter
 }
 
-func NewParser() *Parser {
-	return &Parser{
-		extractors: []LinkExtractor{
-			&AHrefExtractor{},
-			&LinkHrefExtractor{},
-			&AreaHrefExtractor{},
-		},
-		fetcher: http.NewFetcher(),
+// Fetcher is what the pages are fetched with, an *http.Fetcher by default.
+type Fetcher interface {
+	// FetchContext fetches the url following its redirects, aborting once the context is done
+	FetchContext(ctx context.Context, url string) http.FetchResult
+}
+
+// ParserOption customises the Parser, defaults are used for everything which isn't set.
+type ParserOption func(*Parser)
+
+// WithFetcher sets what the pages are fetched with, e.g. an http.Fetcher with a Client of its own
+// or one from http.NewFileFetcher.
+func WithFetcher(fetcher Fetcher) ParserOption {
+	return func(p *Parser) {
+		p.fetcher = fetcher
+	}
+}
+
+// WithExtractors replaces the default extractors, see DefaultExtractors.
+func WithExtractors(extractors ...LinkExtractor) ParserOption {
+	return func(p *Parser) {
+		p.extractors = extractors
+	}
+}
+
+// DefaultExtractors extract the links of `<a>`, `<link>` and `<area>`.
+func DefaultExtractors() []LinkExtractor {
+	return []LinkExtractor{
+		&AHrefExtractor{},
+		&LinkHrefExtractor{},
+		&AreaHrefExtractor{},
+	}
+}
+
+func NewParser(opts ...ParserOption) *Parser {
+	p := &Parser{
+		extractors: DefaultExtractors(),
+		fetcher:    http.NewFetcher(),
 		filters: []filters.Filter{
 			&filters.NotFile{},
 			&filters.NotEmpty{},
@@ -31,46 +64,171 @@ func NewParser() *Parser {
 			&filters.NotTelephone{},
 		},
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Page is what was found by fetching a url.
+type Page struct {
+	// URL is where the page was found after following redirects
+	URL         string
+	StatusCode  int
+	ContentType string
+	// Redirects are the hops which lead to URL, empty when there was no redirect
+	Redirects []http.Redirect
+	// BaseHref is the href of `<base>`, relative links of the page are relative to it when set
+	BaseHref string
+	Links    []Link
+	// Size is the amount of body bytes which were downloaded
+	Size int64
+	// Duration is how long fetching and parsing the page took, redirects included
+	Duration time.Duration
+	// LastModified is the Last-Modified header of the page, zero when it wasn't sent or couldn't be parsed
+	LastModified time.Time
+	// Canonical is the href of `<link rel="canonical">`, empty when there's none
+	Canonical string
+	// NoIndex is whether the page asks not to be indexed, through `<meta name="robots">` or the X-Robots-Tag header
+	NoIndex bool
+	// Anchors are the element ids and `<a name>` of the page, what its `#fragment` links can point to
+	Anchors []string
+}
+
+// Link is a link found on a page.
+type Link struct {
+	Href string
+	// Text is the text of the link with its whitespace collapsed, the alt text for `<area>`
+	Text string
+	// Rel is the rel attribute of the link with its whitespace collapsed e.g. "nofollow noopener"
+	Rel string
+	// Fragment is the decoded `#fragment` of Href without the #, empty when there's none
+	Fragment string
 }
 
 func (p *Parser) FetchLinks(baseUrl string) ([]string, error) {
-	result := p.fetcher.Fetch(baseUrl)
-	if result.Err != nil {
-		return nil, result.Err
+	page, err := p.FetchPage(context.Background(), baseUrl)
+	if err != nil {
+		return nil, err
 	}
+	return hrefs(page.Links), nil
+}
 
-	if result.Location != "" {
-		// It’s a redirect: return as a single link
-		return []string{result.Location}, nil
+// FetchPage fetches the url following its redirects and extracts the links of the page it ends up at.
+// the page is returned even along with an error so the redirects leading to the failure are known.
+// the request is aborted once the context is done.
+func (p *Parser) FetchPage(ctx context.Context, baseUrl string) (*Page, error) {
+	started := time.Now()
+	result := p.fetcher.FetchContext(ctx, baseUrl)
+	page := &Page{
+		URL:         result.URL,
+		StatusCode:  result.StatusCode,
+		ContentType: result.ContentType,
+		Redirects:   result.Redirects,
+	}
+	if result.Header != nil {
+		page.LastModified, _ = nethttp.ParseTime(result.Header.Get("Last-Modified"))
+		page.NoIndex = robotsNoIndex(result.Header.Values("X-Robots-Tag"))
+	}
+	defer func() {
+		page.Duration = time.Since(started)
+	}()
+	if result.Err != nil {
+		return page, result.Err
 	}
 
 	if result.Body == nil {
-		return nil, errors.New("there's no body here")
+		return page, &http.ParseError{Err: errors.New("there's no body here")}
 	}
 	defer result.Body.Close()
-	return p.fetchURLsFromHtml(result.Body)
+	body := &countingReader{reader: result.Body}
+	baseNode, err := p.parseHtml(body)
+	page.Size = body.read
+	if body.err != nil {
+		// reading the body failed rather than parsing it e.g. it timed out or was too large
+		return page, body.err
+	}
+	if err != nil {
+		return page, &http.ParseError{Err: err}
+	}
+	page.BaseHref = findBaseHref(baseNode)
+	page.Canonical = findCanonical(baseNode)
+	page.NoIndex = page.NoIndex || metaNoIndex(baseNode)
+	page.Anchors = findAnchors(baseNode)
+	page.Links = make([]Link, 0)
+	p.extractLinks(baseNode, &page.Links)
+	return page, nil
 }
 
 // input links is assumed to be utf-8 encoded
 func (p *Parser) fetchURLsFromHtml(reader io.ReadCloser) ([]string, error) {
+	baseNode, err := p.parseHtml(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]Link, 0)
+	p.extractLinks(baseNode, &links)
+	return hrefs(links), nil
+}
+
+// countingReader keeps track of the amount of bytes read through it, and of the error reading failed with.
+type countingReader struct {
+	reader io.Reader
+	read   int64
+	err    error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+func hrefs(links []Link) []string {
+	result := make([]string, 0, len(links))
+	for _, link := range links {
+		result = append(result, link.Href)
+	}
+	return result
+}
+
+func (p *Parser) parseHtml(reader io.Reader) (*html.Node, error) {
 	baseNode, err := html.Parse(reader)
 	if err != nil {
 		log.Printf("[Error] failed to parse links: %s\n", err)
 		return nil, err
 	}
+	return baseNode, nil
+}
 
-	links := make([]string, 0)
-	p.extractLinks(baseNode, &links)
-	return links, nil
+// findBaseHref returns the href of the first `<base>` element which has one, the others are ignored.
+func findBaseHref(node *html.Node) string {
+	if node.Type == html.ElementNode && node.Data == "base" {
+		for _, attr := range node.Attr {
+			if attr.Key == "href" {
+				return attr.Val
+			}
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if href := findBaseHref(child); href != "" {
+			return href
+		}
+	}
+	return ""
 }
 
-func (p *Parser) extractLinks(node *html.Node, links *[]string) {
+func (p *Parser) extractLinks(node *html.Node, links *[]Link) {
 	for _, ex := range p.extractors {
 		link, exists := ex.Extract(node)
 		if !exists || !p.isValidLink(link) {
 			continue
 		}
-		*links = append(*links, link)
+		*links = append(*links, Link{Href: link, Text: linkText(node), Rel: attribute(node, "rel"), Fragment: fragment(link)})
 	}
 	node = node.FirstChild
 	for ; node != nil; node = node.NextSibling {
@@ -78,6 +236,36 @@ func (p *Parser) extractLinks(node *html.Node, links *[]string) {
 	}
 }
 
+// attribute returns the value of the node's attribute with its whitespace collapsed, empty when it's not set.
+func attribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return strings.Join(strings.Fields(attr.Val), " ")
+		}
+	}
+	return ""
+}
+
+// linkText returns the text a user sees for the link element.
+func linkText(node *html.Node) string {
+	if node.Data == "area" {
+		return attribute(node, "alt")
+	}
+	var text strings.Builder
+	collectText(node, &text)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+func collectText(node *html.Node, text *strings.Builder) {
+	if node.Type == html.TextNode {
+		text.WriteString(node.Data)
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectText(child, text)
+	}
+}
+
 func (p *Parser) isValidLink(link string) bool {
 	for _, filter := range p.filters {
 		if !filter.Match(link) {
@@ -86,3 +274,5 @@ func (p *Parser) isValidLink(link string) bool {
 	}
 	return true
 }
+
+var _ Fetcher = (*http.Fetcher)(nil)
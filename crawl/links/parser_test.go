@@ -1,11 +1,16 @@
 package links
 
 import (
+	"context"
 	"io"
+	nethttp "net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
 )
 
 func TestParser_FetchLinks(t *testing.T) {
@@ -33,3 +38,101 @@ func TestParser_fetchURLsFromHtml(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"http://example.com/1", "/2"}, links)
 }
+
+func TestParser_LinkTextAndRel(t *testing.T) {
+	htmlStr := `<html><body>
+		<a href="/1" rel=" nofollow   noopener">  Plain
+		  text </a>
+		<a href="/2"><span>Nested</span> <b>text</b></a>
+		<map><area href="/3" alt="Area alt"></map>
+		<link href="/4" rel="stylesheet">
+	</body></html>`
+	node, err := html.Parse(strings.NewReader(htmlStr))
+	assert.NoError(t, err)
+	links := make([]Link, 0)
+	NewParser().extractLinks(node, &links)
+	assert.Equal(t, []Link{
+		{Href: "/1", Text: "Plain text", Rel: "nofollow noopener"},
+		{Href: "/2", Text: "Nested text"},
+		{Href: "/3", Text: "Area alt"},
+		{Href: "/4", Text: "", Rel: "stylesheet"},
+	}, links)
+}
+
+func TestParser_FetchPage_Indexing(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name                 string
+		header               map[string]string
+		body                 string
+		expectedCanonical    string
+		expectedNoIndex      bool
+		expectedLastModified time.Time
+	}{
+		{
+			name:                 "canonical and last modified",
+			header:               map[string]string{"Last-Modified": modified.Format(nethttp.TimeFormat)},
+			body:                 `<html><head><link rel="Canonical" href="/page"><link rel="canonical" href="/other"></head></html>`,
+			expectedCanonical:    "/page",
+			expectedLastModified: modified,
+		},
+		{
+			name:            "noindex meta",
+			body:            `<html><head><meta name="ROBOTS" content="follow, NoIndex"></head></html>`,
+			expectedNoIndex: true,
+		},
+		{
+			name:            "none meta",
+			body:            `<html><head><meta name="robots" content="none"></head></html>`,
+			expectedNoIndex: true,
+		},
+		{
+			name:            "noindex header",
+			header:          map[string]string{"X-Robots-Tag": "noindex"},
+			body:            `<html></html>`,
+			expectedNoIndex: true,
+		},
+		{
+			name:   "noindex for another crawler",
+			header: map[string]string{"X-Robots-Tag": "otherbot: noindex", "Last-Modified": "yesterday"},
+			body:   `<html><head><meta name="description" content="noindex"></head></html>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				for key, value := range test.header {
+					w.Header().Set(key, value)
+				}
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			page, err := NewParser().FetchPage(context.Background(), server.URL)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCanonical, page.Canonical)
+			assert.Equal(t, test.expectedNoIndex, page.NoIndex)
+			assert.True(t, test.expectedLastModified.Equal(page.LastModified), "last modified %v", page.LastModified)
+		})
+	}
+}
+
+func TestParser_FetchPage_Anchors(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		_, _ = w.Write([]byte(`<html><body>
+			<h2 id="intro">Intro</h2><a name="legacy"></a><div name="not-an-anchor"></div><p id="intro">Again</p>
+			<a href="#intro">Up</a> <a href="/guide#caf%C3%A9">Guide</a> <a href="/plain">Plain</a>
+		</body></html>`))
+	}))
+	defer server.Close()
+
+	page, err := NewParser().FetchPage(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"intro", "legacy"}, page.Anchors)
+	assert.Equal(t, []Link{
+		{Href: "#intro", Text: "Up", Fragment: "intro"},
+		{Href: "/guide#caf%C3%A9", Text: "Guide", Fragment: "café"},
+		{Href: "/plain", Text: "Plain"},
+	}, page.Links)
+}
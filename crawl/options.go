@@ -0,0 +1,171 @@
+package crawl
+
+import (
+	"spiderman/crawl/filters"
+	"spiderman/crawl/http"
+	"spiderman/crawl/links"
+	"spiderman/crawl/urlnorm"
+	"spiderman/crawl/visited"
+)
+
+// Option customises the Crawler, defaults are used for everything which isn't set.
+type Option func(*Crawler)
+
+// WithPoliteness sets how hard a single host can be hit.
+func WithPoliteness(politeness Politeness) Option {
+	return func(c *Crawler) {
+		c.politeness = politeness
+	}
+}
+
+// WithFetcher sets what the pages and robots.txt are fetched with, e.g. an http.Fetcher with a Client of its own,
+// http.NewFileFetcher to crawl a local copy of a site or http.NewFixtureFetcher to replay a recorded crawl.
+func WithFetcher(fetcher links.Fetcher) Option {
+	return func(c *Crawler) {
+		c.fetcher = fetcher
+	}
+}
+
+// WithSeeds adds urls the crawl starts from on top of the one given to NewCrawler,
+// their hosts are in the scope of the crawl unless WithScope sets it, see WithScopeMode.
+func WithSeeds(seeds ...string) Option {
+	return func(c *Crawler) {
+		c.extraSeeds = append(c.extraSeeds, seeds...)
+	}
+}
+
+// WithScope sets which links stay within the crawl, e.g. a filters.Scope listing hosts and "*.example.com" subdomains.
+// links out of scope are published as external and not crawled.
+func WithScope(scope filters.Filter) Option {
+	return func(c *Crawler) {
+		c.internal = scope
+	}
+}
+
+// WithScopeMode sets how far from the hosts of the seeds the crawl goes when WithScope isn't used,
+// filters.ScopeHostWWW by default.
+func WithScopeMode(mode filters.ScopeMode) Option {
+	return func(c *Crawler) {
+		c.scopeMode = mode
+	}
+}
+
+// WithUserAgent sets the User-Agent header the pages are requested with, when the default fetcher is used,
+// and the robots.txt groups which apply to the crawl through its product token e.g. "mybot" for "MyBot/1.2".
+func WithUserAgent(userAgent string) Option {
+	return func(c *Crawler) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithFilters replaces the default filters deciding which links are crawled,
+// staying on the site and following robots.txt are then up to the filters given.
+func WithFilters(chain ...filters.Filter) Option {
+	return func(c *Crawler) {
+		c.filterChain = chain
+	}
+}
+
+// WithExtraFilters adds filters on top of the default ones (or the ones of WithFilters),
+// they're checked before robots.txt so it's only fetched for the links they let through.
+func WithExtraFilters(extra ...filters.Filter) Option {
+	return func(c *Crawler) {
+		c.extraFilters = append(c.extraFilters, extra...)
+	}
+}
+
+// WithRules includes or excludes the urls matching the rules, e.g. to crawl only /docs/** without /admin.
+// they're matched on the normalized absolute urls before the other filters.
+func WithRules(rules *filters.Rules) Option {
+	return func(c *Crawler) {
+		c.rules = rules
+	}
+}
+
+// WithExtractors replaces the default extractors finding the links of a page, see links.DefaultExtractors.
+func WithExtractors(extractors ...links.LinkExtractor) Option {
+	return func(c *Crawler) {
+		c.extractors = extractors
+	}
+}
+
+// WithExtraExtractors adds extractors on top of the default ones (or the ones of WithExtractors).
+func WithExtraExtractors(extra ...links.LinkExtractor) Option {
+	return func(c *Crawler) {
+		c.extraExtractors = append(c.extraExtractors, extra...)
+	}
+}
+
+// WithWorkers sets how many pages CrawlContext fetches at once, 1 crawling sequentially.
+func WithWorkers(workers int) Option {
+	return func(c *Crawler) {
+		c.workers = workers
+	}
+}
+
+// WithHooks sets the functions called as the crawl goes, see Hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(c *Crawler) {
+		c.hooks = hooks
+	}
+}
+
+// WithRetryPolicy sets which failed pages are fetched again and when.
+func WithRetryPolicy(policy http.RetryPolicy) Option {
+	return func(c *Crawler) {
+		c.retry = policy
+	}
+}
+
+// WithNormalizer sets the rules urls are normalized with before being queued and published.
+func WithNormalizer(normalizer urlnorm.Normalizer) Option {
+	return func(c *Crawler) {
+		c.normalizer = normalizer
+	}
+}
+
+// WithMaxDepth stops following links deeper than depth from the seed, the seed being at depth 0.
+// pages at the max depth are still crawled and published, their links just aren't followed.
+func WithMaxDepth(depth int) Option {
+	return func(c *Crawler) {
+		c.maxDepth = depth
+	}
+}
+
+// WithBudget bounds how much the crawl can do, the crawl ends early once a budget is hit.
+func WithBudget(budget Budget) Option {
+	return func(c *Crawler) {
+		c.budget = budget
+	}
+}
+
+// WithCheckpoint saves the progress of the crawl so it can be resumed, see Checkpoint.
+func WithCheckpoint(checkpoint Checkpoint) Option {
+	return func(c *Crawler) {
+		c.checkpoint = checkpoint
+	}
+}
+
+// WithFrontier sets where the tasks wait to be crawled, newFrontier is called at the start of every crawl.
+// e.g. a DiskFrontier keeps the memory bounded on sites with millions of urls.
+func WithFrontier(newFrontier func() (Frontier, error)) Option {
+	return func(c *Crawler) {
+		c.newFrontier = newFrontier
+	}
+}
+
+// WithVisitedSet sets how urls are deduplicated, newSet is called for every set a crawl needs.
+// e.g. a visited.ScalableBloom uses a fraction of the memory, at the cost of a few urls never being crawled.
+func WithVisitedSet(newSet func() visited.Set) Option {
+	return func(c *Crawler) {
+		c.newVisitedSet = newSet
+	}
+}
+
+// WithLinkChecker makes the checks of the checker with the fetcher, retry policy and politeness of the crawler,
+// for a checker which isn't the publisher itself but is wrapped e.g. in publish.Multi or publish.NewAsyncPublisher.
+func WithLinkChecker(checker *LinkChecker) Option {
+	return func(c *Crawler) {
+		c.linkChecker = checker
+	}
+}
@@ -1,88 +1,175 @@
 package crawl
 
-import "sync"
+import (
+	"log"
+	"sync"
+
+	"spiderman/crawl/visited"
+)
+
+// Task is a queued url along with how it was discovered.
+type Task struct {
+	URL string
+	// Seed is the seed the url was reached from
+	Seed string
+	// Depth is the amount of links followed from the seed to get here, the seed being 0
+	Depth int
+	// Parent is the page the url was found on, empty for the seed
+	Parent string
+	// AnchorText is the text of the link on the parent page
+	AnchorText string
+}
 
 // FifoQueue guarantees ordering for messages with a First-in first-out approach
 // it is not safe for concurrent usage.
+// Tasks are deduplicated by their url, the first one added wins.
 type FifoQueue struct {
-	elements   []string
-	elementSet map[string]bool
+	frontier Frontier
+	seen     visited.Set
 }
 
 func NewFifoQueue() *FifoQueue {
+	return NewFifoQueueWith(NewMemoryFrontier(), visited.NewExactSet())
+}
+
+// NewFifoQueueWith keeps the queued tasks in the frontier, which is closed along with the queue,
+// and the urls ever queued in the seen set.
+func NewFifoQueueWith(frontier Frontier, seen visited.Set) *FifoQueue {
 	return &FifoQueue{
-		elementSet: make(map[string]bool),
-		elements:   make([]string, 0),
+		frontier: frontier,
+		seen:     seen,
 	}
 }
 
-func (q *FifoQueue) Add(element string) {
-	if q.elementSet[element] {
+func (q *FifoQueue) Add(task Task) {
+	if !q.seen.Add(task.URL) {
 		return
 	}
-	q.elements = append(q.elements, element)
-	q.elementSet[element] = true
+	if err := q.frontier.Push(task); err != nil {
+		log.Printf("[Error] failed to queue %s: %s\n", task.URL, err)
+	}
+}
+
+// MarkSeen marks the element as seen without queueing it, so it's never added afterward.
+// Returns false if it was already seen.
+func (q *FifoQueue) MarkSeen(element string) bool {
+	return q.seen.Add(element)
 }
 
 // Grab returns the first element from the queue
-// if queue is empty, returns an empty string
-func (q *FifoQueue) Grab() string {
-	if len(q.elements) == 0 {
-		return ""
-	}
-	result := q.elements[0]
-	q.elements = q.elements[1:]
-	return result
+// if queue is empty, returns an empty Task
+func (q *FifoQueue) Grab() Task {
+	task, _ := q.frontier.Pop()
+	return task
+}
+
+func (q *FifoQueue) Close() error {
+	return q.frontier.Close()
 }
 
 // TaskQueue doesn't guarantee ordering but is safe for concurrent usage
-// it guarantees non-duplicate elements
+// it guarantees non-duplicate urls.
+// Add never blocks, the tasks wait in the frontier until they're taken from QueuedTasks.
 type TaskQueue struct {
-	queue   chan string
-	visited sync.Map
-	queued  sync.Map
-	closed  chan struct{}
+	frontier Frontier
+	visited  visited.Set
+	queued   visited.Set
+	// wake is signalled whenever a task is added, so feed doesn't have to poll the frontier
+	wake   chan struct{}
+	out    chan Task
+	closed chan struct{}
+	once   sync.Once
+}
+
+func NewTaskQueue() *TaskQueue {
+	return NewTaskQueueWith(NewMemoryFrontier(), visited.NewExactSet(), visited.NewExactSet())
 }
 
-func NewTaskQueue(seedUrl string, size int) *TaskQueue {
+// NewTaskQueueWith keeps the queued tasks in the frontier, which is closed along with the queue.
+// queuedSet holds the urls ever queued and visitedSet the ones which were crawled.
+func NewTaskQueueWith(frontier Frontier, queuedSet, visitedSet visited.Set) *TaskQueue {
 	q := &TaskQueue{
-		queue:  make(chan string, size), // buffer size can be configurable
-		closed: make(chan struct{}),
+		frontier: frontier,
+		queued:   queuedSet,
+		visited:  visitedSet,
+		wake:     make(chan struct{}, 1),
+		out:      make(chan Task),
+		closed:   make(chan struct{}),
 	}
-
-	q.queued.Store(seedUrl, true)
-	q.queue <- seedUrl
-
+	go q.feed()
 	return q
 }
 
-// Add adds a URL to the queue if not already queued.
-// Returns true if URL was added, false if duplicate or closed.
-func (q *TaskQueue) Add(url string) bool {
-	if _, loaded := q.queued.LoadOrStore(url, true); loaded {
-		return false
-	}
-
+// Add adds a task to the queue if its URL is not already queued.
+// Returns true if it was added, false if duplicate or closed.
+func (q *TaskQueue) Add(task Task) bool {
 	select {
-	case q.queue <- url:
-		return true
 	case <-q.closed:
 		return false
+	default:
+	}
+	if !q.queued.Add(task.URL) {
+		return false
+	}
+	if err := q.frontier.Push(task); err != nil {
+		log.Printf("[Error] failed to queue %s: %s\n", task.URL, err)
+		return false
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
 	}
+	return true
 }
 
 // MarkVisited returns true if the url was NOT visited before, marking it now.
 // Returns false if already visited.
 func (q *TaskQueue) MarkVisited(url string) bool {
-	_, loaded := q.visited.LoadOrStore(url, true)
-	return !loaded
+	return q.visited.Add(url)
 }
 
-func (q *TaskQueue) QueuedTasks() <-chan string {
-	return q.queue
+// MarkSeen marks the url as queued and visited without queueing it, so it's never crawled afterward.
+func (q *TaskQueue) MarkSeen(url string) {
+	q.queued.Add(url)
+	q.visited.Add(url)
+}
+
+// QueuedTasks returns the queued tasks, it's closed once the queue is.
+func (q *TaskQueue) QueuedTasks() <-chan Task {
+	return q.out
+}
+
+// Len is the amount of tasks waiting in the queue.
+func (q *TaskQueue) Len() int {
+	return q.frontier.Len()
 }
 
 func (q *TaskQueue) Close() {
-	close(q.closed)
-	close(q.queue)
+	q.once.Do(func() {
+		close(q.closed)
+		if err := q.frontier.Close(); err != nil {
+			log.Printf("[Error] failed to close frontier: %s\n", err)
+		}
+	})
+}
+
+// feed moves the tasks from the frontier to QueuedTasks until the queue is closed.
+func (q *TaskQueue) feed() {
+	defer close(q.out)
+	for {
+		task, ok := q.frontier.Pop()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.closed:
+				return
+			}
+		}
+		select {
+		case q.out <- task:
+		case <-q.closed:
+			return
+		}
+	}
 }
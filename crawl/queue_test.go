@@ -1,6 +1,9 @@
 package crawl
 
 import (
+	"fmt"
+	"os"
+	"spiderman/crawl/visited"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,16 +12,64 @@ import (
 func TestQueueBehavior(t *testing.T) {
 	q := NewFifoQueue()
 	// Single add/grab
-	q.Add("x")
-	assert.Equal(t, "x", q.Grab())
-	// Empty queue returns empty string
-	assert.Equal(t, "", q.Grab())
+	q.Add(Task{URL: "x"})
+	assert.Equal(t, "x", q.Grab().URL)
+	// Empty queue returns empty task
+	assert.Equal(t, Task{}, q.Grab())
 	// AddAll and repeated Grab
-	q.Add("a")
-	q.Add("b")
-	q.Add("c")
-	assert.Equal(t, "a", q.Grab())
-	assert.Equal(t, "b", q.Grab())
-	assert.Equal(t, "c", q.Grab())
-	assert.Equal(t, "", q.Grab())
+	q.Add(Task{URL: "a"})
+	q.Add(Task{URL: "b", Depth: 1, Parent: "a", AnchorText: "B"})
+	q.Add(Task{URL: "c"})
+	assert.Equal(t, "a", q.Grab().URL)
+	assert.Equal(t, Task{URL: "b", Depth: 1, Parent: "a", AnchorText: "B"}, q.Grab())
+	assert.Equal(t, "c", q.Grab().URL)
+	assert.Equal(t, Task{}, q.Grab())
+}
+
+func TestQueueDeduplicatesByUrl(t *testing.T) {
+	q := NewFifoQueue()
+	q.Add(Task{URL: "a", Depth: 1})
+	q.Add(Task{URL: "a", Depth: 2})
+	assert.Equal(t, Task{URL: "a", Depth: 1}, q.Grab())
+	assert.Equal(t, Task{}, q.Grab())
+}
+
+func TestTaskQueue_AddNeverBlocks(t *testing.T) {
+	q := NewTaskQueue()
+	defer q.Close()
+
+	// nothing is taking from the queue meanwhile
+	for i := 0; i < 10000; i++ {
+		assert.True(t, q.Add(Task{URL: fmt.Sprint(i)}))
+	}
+	assert.False(t, q.Add(Task{URL: "0"}))
+
+	for i := 0; i < 10000; i++ {
+		assert.Equal(t, fmt.Sprint(i), (<-q.QueuedTasks()).URL)
+	}
+}
+
+func TestTaskQueue_Close(t *testing.T) {
+	q := NewTaskQueue()
+	q.Add(Task{URL: "a"})
+	q.Close()
+
+	assert.False(t, q.Add(Task{URL: "b"}))
+	// QueuedTasks gets closed, "a" might have made it out before
+	left := 0
+	for range q.QueuedTasks() {
+		left++
+	}
+	assert.LessOrEqual(t, left, 1)
+}
+
+func TestTaskQueue_FailedPush(t *testing.T) {
+	frontier, err := NewDiskFrontier(t.TempDir(), 1)
+	assert.NoError(t, err)
+	queue := NewTaskQueueWith(frontier, visited.NewExactSet(), visited.NewExactSet())
+	defer queue.Close()
+	assert.NoError(t, os.RemoveAll(frontier.dir))
+
+	assert.False(t, queue.Add(Task{URL: "http://a.com/"}))
+	assert.Equal(t, 0, queue.Len())
 }
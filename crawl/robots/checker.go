@@ -0,0 +1,130 @@
+package robots
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"spiderman/crawl/http"
+)
+
+// Checker fetches and caches robots.txt for every host it's asked about.
+// it is safe for concurrent usage, robots.txt is only fetched once per host.
+type Checker struct {
+	fetcher   Fetcher
+	userAgent string
+
+	mu    sync.Mutex
+	hosts map[string]*hostRules
+}
+
+type hostRules struct {
+	mu sync.Mutex
+	// rules is nil until robots.txt was fetched
+	rules *Rules
+}
+
+// Fetcher is what robots.txt is fetched with, retrying as it sees fit e.g. an *http.Fetcher.
+// it's expected to give up once the context is done.
+type Fetcher interface {
+	FetchWithRetryContext(ctx context.Context, url string) http.FetchResult
+}
+
+func NewChecker(fetcher Fetcher, userAgent string) *Checker {
+	return &Checker{
+		fetcher:   fetcher,
+		userAgent: userAgent,
+		hosts:     make(map[string]*hostRules),
+	}
+}
+
+// Allowed checks whether the absolute url can be crawled according to the robots.txt of its host.
+// urls which can't be parsed or aren't http(s) are left for the other filters to decide.
+func (c *Checker) Allowed(rawUrl string) bool {
+	return c.AllowedContext(context.Background(), rawUrl)
+}
+
+// AllowedContext is Allowed which gives up on fetching robots.txt once the context is done,
+// the url isn't allowed then.
+func (c *Checker) AllowedContext(ctx context.Context, rawUrl string) bool {
+	u, ok := parseHttpUrl(rawUrl)
+	if !ok {
+		return true
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return c.rulesFor(ctx, u.Scheme, u.Host).Allowed(c.userAgent, path)
+}
+
+// CrawlDelay returns the Crawl-delay which the robots.txt of the url's host asks for.
+func (c *Checker) CrawlDelay(rawUrl string) time.Duration {
+	return c.CrawlDelayContext(context.Background(), rawUrl)
+}
+
+// CrawlDelayContext is CrawlDelay which gives up on fetching robots.txt once the context is done.
+func (c *Checker) CrawlDelayContext(ctx context.Context, rawUrl string) time.Duration {
+	u, ok := parseHttpUrl(rawUrl)
+	if !ok {
+		return 0
+	}
+	return c.rulesFor(ctx, u.Scheme, u.Host).CrawlDelay(c.userAgent)
+}
+
+func parseHttpUrl(rawUrl string) (*url.URL, bool) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return nil, false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, false
+	}
+	return u, true
+}
+
+// rulesFor returns the cached rules of the host, fetching them on first access.
+// the host is disallowed when the context is done before they could be fetched, without caching it
+// so they're fetched again on the next access.
+func (c *Checker) rulesFor(ctx context.Context, scheme, host string) *Rules {
+	key := scheme + "://" + strings.ToLower(host)
+	c.mu.Lock()
+	entry, exists := c.hosts[key]
+	if !exists {
+		entry = &hostRules{}
+		c.hosts[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.rules != nil {
+		return entry.rules
+	}
+	rules := c.fetch(ctx, key+"/robots.txt")
+	if ctx.Err() != nil {
+		return DisallowAll()
+	}
+	entry.rules = rules
+	return rules
+}
+
+// fetch follows RFC 9309 when robots.txt can't be read:
+// - 4xx means there are no restrictions
+// - 5xx or network errors mean the whole host is disallowed
+func (c *Checker) fetch(ctx context.Context, robotsUrl string) *Rules {
+	result := c.fetcher.FetchWithRetryContext(ctx, robotsUrl)
+	if result.Err != nil || result.Body == nil {
+		if result.StatusCode >= 400 && result.StatusCode < 500 {
+			return AllowAll()
+		}
+		return DisallowAll()
+	}
+	defer result.Body.Close()
+	return Parse(result.Body)
+}
+
+var _ Fetcher = (*http.Fetcher)(nil)
@@ -0,0 +1,43 @@
+package robots
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"spiderman/crawl/filters"
+)
+
+// Filter rejects the links which are disallowed by robots.txt.
+// relative links are resolved against the base url before checking.
+type Filter struct {
+	base    *url.URL
+	checker *Checker
+}
+
+func NewFilter(baseUrl string, checker *Checker) filters.Filter {
+	base, err := url.Parse(strings.TrimSpace(baseUrl))
+	if err != nil {
+		base = &url.URL{}
+	}
+	return &Filter{base: base, checker: checker}
+}
+
+func (f *Filter) Match(link string) bool {
+	return f.MatchContext(context.Background(), link)
+}
+
+// MatchContext is Match which gives up on fetching robots.txt once the context is done, the link is rejected then.
+func (f *Filter) MatchContext(ctx context.Context, link string) bool {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return false
+	}
+	return f.checker.AllowedContext(ctx, f.base.ResolveReference(u).String())
+}
+
+func (f *Filter) String() string {
+	return "robots.txt"
+}
+
+var _ filters.ContextFilter = (*Filter)(nil)
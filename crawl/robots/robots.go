@@ -0,0 +1,236 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUserAgent is the product token the crawler identifies itself with
+// when picking a group out of a robots.txt file.
+const DefaultUserAgent = "spiderman"
+
+// ProductToken returns the product token of a User-Agent header e.g. "mybot" for "MyBot/1.2 (+https://example.com/bot)",
+// which is what robots.txt groups are matched against.
+func ProductToken(userAgent string) string {
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return ""
+	}
+	token, _, _ := strings.Cut(fields[0], "/")
+	return strings.ToLower(token)
+}
+
+// MaxCrawlDelay is the longest Crawl-delay honored, longer ones are clamped to it
+// so a single robots.txt can't hold up the crawl of its host for hours.
+const MaxCrawlDelay = 60 * time.Second
+
+// maxRobotsSize is the amount of a robots.txt file that gets parsed,
+// RFC 9309 asks crawlers to parse at least 500 KiB.
+const maxRobotsSize = 500 * 1024
+
+// Rules is a parsed robots.txt file.
+// a nil *Rules allows everything.
+type Rules struct {
+	groups []*group
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// AllowAll returns rules which allow every path,
+// used when a robots.txt file doesn't exist.
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+// DisallowAll returns rules which disallow every path,
+// used when a robots.txt file couldn't be reached.
+func DisallowAll() *Rules {
+	return &Rules{
+		groups: []*group{{
+			agents: []string{"*"},
+			rules:  []rule{{allow: false, pattern: "/"}},
+		}},
+	}
+}
+
+// Parse reads a robots.txt file. It's lenient towards malformed lines and just skips them.
+func Parse(reader io.Reader) *Rules {
+	rules := &Rules{}
+	scanner := bufio.NewScanner(io.LimitReader(reader, maxRobotsSize))
+	scanner.Buffer(make([]byte, 0, 4096), maxRobotsSize)
+
+	var current *group
+	// consecutive user-agent lines share the same group
+	collectingAgents := false
+	for scanner.Scan() {
+		key, value, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		switch key {
+		case "user-agent":
+			if !collectingAgents {
+				current = &group{}
+				rules.groups = append(rules.groups, current)
+				collectingAgents = true
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			collectingAgents = false
+			if current == nil {
+				continue
+			}
+			// an empty disallow means nothing is disallowed
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			collectingAgents = false
+			if current == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(value, 64)
+			// NaN isn't >= 0 either
+			if err != nil || !(seconds >= 0) {
+				continue
+			}
+			if seconds > MaxCrawlDelay.Seconds() {
+				log.Printf("[Robots] Crawl-delay of %s seconds clamped to %s\n", value, MaxCrawlDelay)
+				current.crawlDelay = MaxCrawlDelay
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		default:
+			// sitemap and other non-group lines don't end the list of user agents
+			// as they are not part of any group
+		}
+	}
+	return rules
+}
+
+func parseLine(line string) (string, string, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	key, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+	return key, value, key != ""
+}
+
+// Allowed checks whether the given user agent may crawl the path.
+// path is expected to be the escaped path of the url along with the query string.
+func (r *Rules) Allowed(userAgent, path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	// robots.txt itself is always allowed
+	if path == "/robots.txt" {
+		return true
+	}
+	matched := false
+	allowed := true
+	longest := -1
+	for _, g := range r.groupsFor(userAgent) {
+		for _, rl := range g.rules {
+			if !matchPattern(rl.pattern, path) {
+				continue
+			}
+			length := len(rl.pattern)
+			// the most specific rule wins, allow wins in case of a tie
+			if length > longest || (length == longest && rl.allow) {
+				longest = length
+				allowed = rl.allow
+				matched = true
+			}
+		}
+	}
+	return !matched || allowed
+}
+
+// CrawlDelay returns the Crawl-delay asked for the user agent, 0 if there is none.
+// Crawl-delay isn't part of RFC 9309 but is widely used, so the largest value of the matching groups is honored.
+func (r *Rules) CrawlDelay(userAgent string) time.Duration {
+	if r == nil {
+		return 0
+	}
+	var delay time.Duration
+	for _, g := range r.groupsFor(userAgent) {
+		delay = max(delay, g.crawlDelay)
+	}
+	return delay
+}
+
+// groupsFor returns all the groups for the user agent,
+// falling back to the `*` groups if there are no specific ones.
+func (r *Rules) groupsFor(userAgent string) []*group {
+	userAgent = strings.ToLower(userAgent)
+	var specific, fallback []*group
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				fallback = append(fallback, g)
+				break
+			}
+			if agent == userAgent {
+				specific = append(specific, g)
+				break
+			}
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return fallback
+}
+
+// matchPattern matches robots.txt path patterns,
+// `*` matches any sequence of characters and a trailing `$` anchors the pattern to the end of the path.
+func matchPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+
+	// first part has to be a prefix since patterns always match from the start of the path
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return true
+}
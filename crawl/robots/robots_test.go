@@ -0,0 +1,224 @@
+package robots
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spiderman/crawl/http"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const robotsTxt = `
+# comments are ignored
+User-agent: googlebot
+Disallow: /
+
+User-agent: Spiderman
+User-agent: otherbot
+Disallow: /private
+Allow: /private/public
+Disallow: /*.php$
+Disallow: /search*q=
+
+User-agent: *
+Disallow: /everyone-but-spiderman
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestRules_Allowed(t *testing.T) {
+	rules := Parse(strings.NewReader(robotsTxt))
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{
+			name:      "path without rules",
+			userAgent: "spiderman",
+			path:      "/about",
+			expected:  true,
+		},
+		{
+			name:      "disallowed prefix",
+			userAgent: "spiderman",
+			path:      "/private/page",
+			expected:  false,
+		},
+		{
+			name:      "longer allow wins over disallow",
+			userAgent: "spiderman",
+			path:      "/private/public/page",
+			expected:  true,
+		},
+		{
+			name:      "end anchored wildcard",
+			userAgent: "spiderman",
+			path:      "/dir/index.php",
+			expected:  false,
+		},
+		{
+			name:      "end anchored wildcard with something after",
+			userAgent: "spiderman",
+			path:      "/dir/index.php?x=1",
+			expected:  true,
+		},
+		{
+			name:      "wildcard in the middle",
+			userAgent: "spiderman",
+			path:      "/search/all?q=shoes",
+			expected:  false,
+		},
+		{
+			name:      "user agent matching is case insensitive",
+			userAgent: "SPIDERMAN",
+			path:      "/private",
+			expected:  false,
+		},
+		{
+			name:      "specific group replaces the star group",
+			userAgent: "spiderman",
+			path:      "/everyone-but-spiderman",
+			expected:  true,
+		},
+		{
+			name:      "unknown agent falls back to star group",
+			userAgent: "somebot",
+			path:      "/everyone-but-spiderman",
+			expected:  false,
+		},
+		{
+			name:      "agents sharing a group",
+			userAgent: "otherbot",
+			path:      "/private",
+			expected:  false,
+		},
+		{
+			name:      "robots.txt is always allowed",
+			userAgent: "googlebot",
+			path:      "/robots.txt",
+			expected:  true,
+		},
+		{
+			name:      "disallow everything",
+			userAgent: "googlebot",
+			path:      "/",
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rules.Allowed(tt.userAgent, tt.path))
+		})
+	}
+}
+
+func TestRules_EmptyDisallow(t *testing.T) {
+	rules := Parse(strings.NewReader("User-agent: *\nDisallow:\n"))
+	assert.True(t, rules.Allowed(DefaultUserAgent, "/anything"))
+}
+
+func TestChecker_Allowed(t *testing.T) {
+	robotsFetches := 0
+	mux := nethttp.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		robotsFetches++
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /admin\n"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	checker := NewChecker(http.NewFetcher(), DefaultUserAgent)
+	assert.True(t, checker.Allowed(server.URL+"/about"))
+	assert.False(t, checker.Allowed(server.URL+"/admin/users"))
+	assert.True(t, checker.Allowed("mailto:someone@example.com"))
+	assert.Equal(t, 1, robotsFetches)
+}
+
+func TestChecker_UnavailableRobots(t *testing.T) {
+	notFound := httptest.NewServer(nethttp.NotFoundHandler())
+	defer notFound.Close()
+	broken := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	fetcher := http.NewFetcher()
+	fetcher.Retry = http.NoRetries()
+	checker := NewChecker(fetcher, DefaultUserAgent)
+	assert.True(t, checker.Allowed(notFound.URL+"/page"))
+	assert.False(t, checker.Allowed(broken.URL+"/page"))
+}
+
+func TestChecker_AllowedContext_Cancelled(t *testing.T) {
+	var robotsFetches atomic.Int32
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if robotsFetches.Add(1) == 1 {
+			// hangs until the request is aborted
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /admin\n"))
+	}))
+	defer server.Close()
+
+	checker := NewChecker(http.NewFetcher(), DefaultUserAgent)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.False(t, checker.AllowedContext(ctx, server.URL+"/about"))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the rules of a fetch which was given up on aren't kept
+	assert.True(t, checker.Allowed(server.URL+"/about"))
+	assert.False(t, checker.Allowed(server.URL+"/admin"))
+	assert.EqualValues(t, 2, robotsFetches.Load())
+}
+
+func TestFilter_Match(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /admin\n"))
+	}))
+	defer server.Close()
+
+	filter := NewFilter(server.URL, NewChecker(http.NewFetcher(), DefaultUserAgent))
+	assert.True(t, filter.Match("/about"))
+	assert.False(t, filter.Match("/admin"))
+	assert.False(t, filter.Match(server.URL+"/admin/settings"))
+}
+
+func TestRules_CrawlDelay(t *testing.T) {
+	rules := Parse(strings.NewReader("User-agent: spiderman\nCrawl-delay: 1.5\n\nUser-agent: *\nCrawl-delay: 10\n"))
+	assert.Equal(t, 1500*time.Millisecond, rules.CrawlDelay(DefaultUserAgent))
+	assert.Equal(t, 10*time.Second, rules.CrawlDelay("otherbot"))
+	assert.Equal(t, time.Duration(0), AllowAll().CrawlDelay(DefaultUserAgent))
+
+	// too long or not a number
+	rules = Parse(strings.NewReader("User-agent: spiderman\nCrawl-delay: 86400\n\nUser-agent: otherbot\nCrawl-delay: 1e300\n\nUser-agent: *\nCrawl-delay: NaN\n"))
+	assert.Equal(t, MaxCrawlDelay, rules.CrawlDelay(DefaultUserAgent))
+	assert.Equal(t, MaxCrawlDelay, rules.CrawlDelay("otherbot"))
+	assert.Equal(t, time.Duration(0), rules.CrawlDelay("thirdbot"))
+}
+
+func TestProductToken(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  string
+	}{
+		{userAgent: "MyBot/1.2 (+https://example.com/bot)", expected: "mybot"},
+		{userAgent: "spiderman", expected: "spiderman"},
+		{userAgent: "  Other-Bot ", expected: "other-bot"},
+		{userAgent: "", expected: ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ProductToken(test.userAgent), test.userAgent)
+	}
+}
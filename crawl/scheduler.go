@@ -0,0 +1,201 @@
+package crawl
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Politeness configures how hard a single host gets hit.
+type Politeness struct {
+	// MinDelay is the minimum time between two requests to the same host,
+	// a bigger Crawl-delay from robots.txt takes precedence over it.
+	MinDelay time.Duration
+	// MaxPerHost caps the concurrent requests to the same host.
+	MaxPerHost int
+	// MaxPending caps the tasks waiting in the scheduler for their host, Submit blocks once it's reached
+	// so the rest wait in the frontier, which is what keeps memory bounded on huge sites.
+	MaxPending int
+}
+
+// defaultMaxPending is the MaxPending of a Politeness which doesn't set it.
+const defaultMaxPending = 1000
+
+func DefaultPoliteness() Politeness {
+	return Politeness{
+		MinDelay:   100 * time.Millisecond,
+		MaxPerHost: 4,
+		MaxPending: defaultMaxPending,
+	}
+}
+
+// HostScheduler sits between the queue and the workers and hands out tasks
+// only when their host can take another request.
+// tasks of different hosts don't wait on each other.
+// it is safe for concurrent usage.
+type HostScheduler struct {
+	politeness Politeness
+	// delayFor returns the extra delay a host asks for, e.g. robots.txt Crawl-delay
+	delayFor func(url string) time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+	// slots holds a token per pending task, Submit waits for room in it
+	slots  chan struct{}
+	ready  chan Task
+	wake   chan struct{}
+	closed chan struct{}
+}
+
+type hostState struct {
+	pending []Task
+	active  int
+	delay   time.Duration
+	nextAt  time.Time
+}
+
+func NewHostScheduler(politeness Politeness, delayFor func(url string) time.Duration) *HostScheduler {
+	if politeness.MaxPerHost <= 0 {
+		politeness.MaxPerHost = 1
+	}
+	if politeness.MaxPending <= 0 {
+		politeness.MaxPending = defaultMaxPending
+	}
+	s := &HostScheduler{
+		politeness: politeness,
+		delayFor:   delayFor,
+		hosts:      make(map[string]*hostState),
+		slots:      make(chan struct{}, politeness.MaxPending),
+		ready:      make(chan Task),
+		wake:       make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Submit hands over the task for scheduling, it never blocks on the host's politeness
+// but it does while MaxPending tasks are already waiting. the task is dropped if the scheduler gets closed meanwhile.
+func (s *HostScheduler) Submit(task Task) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-s.closed:
+		return
+	}
+	host := hostOf(task.URL)
+	s.mu.Lock()
+	state, exists := s.hosts[host]
+	s.mu.Unlock()
+	if !exists {
+		// looked up outside the lock since it might need a request (robots.txt)
+		delay := s.politeness.MinDelay
+		if s.delayFor != nil {
+			delay = max(delay, s.delayFor(task.URL))
+		}
+		s.mu.Lock()
+		if state, exists = s.hosts[host]; !exists {
+			state = &hostState{delay: delay}
+			s.hosts[host] = state
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	state.pending = append(state.pending, task)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// SubmitAfter submits the task once the delay has passed, used for retries.
+// nothing is held up meanwhile, the caller included once MaxPending is reached.
+func (s *HostScheduler) SubmitAfter(task Task, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		s.Submit(task)
+	})
+}
+
+// Ready returns the tasks which can be fetched right away.
+// every task received must be reported back with Done once fetched.
+func (s *HostScheduler) Ready() <-chan Task {
+	return s.ready
+}
+
+// Done frees up the host's slot taken by the task.
+func (s *HostScheduler) Done(task Task) {
+	s.mu.Lock()
+	if state, exists := s.hosts[hostOf(task.URL)]; exists && state.active > 0 {
+		state.active--
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Close stops the scheduler, pending tasks are dropped and Ready gets closed.
+func (s *HostScheduler) Close() {
+	close(s.closed)
+}
+
+func (s *HostScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *HostScheduler) run() {
+	defer close(s.ready)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		task, wait, found := s.next()
+		if found {
+			select {
+			case s.ready <- task:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-s.wake:
+		case <-timer.C:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// next picks the task of a host which is free to be requested, reserving the host's slot.
+// when there is none, it returns how long to wait before something could become free.
+func (s *HostScheduler) next() (Task, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	wait := time.Hour
+	for _, state := range s.hosts {
+		if len(state.pending) == 0 || state.active >= s.politeness.MaxPerHost {
+			continue
+		}
+		if until := state.nextAt.Sub(now); until > 0 {
+			wait = min(wait, until)
+			continue
+		}
+		task := state.pending[0]
+		state.pending = state.pending[1:]
+		<-s.slots
+		state.active++
+		state.nextAt = now.Add(state.delay)
+		return task, 0, true
+	}
+	return Task{}, wait, false
+}
+
+func hostOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostScheduler_DelaysSameHost(t *testing.T) {
+	scheduler := NewHostScheduler(Politeness{MinDelay: 50 * time.Millisecond, MaxPerHost: 5}, nil)
+	defer scheduler.Close()
+
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	scheduler.Submit(Task{URL: "http://a.com/2"})
+	start := time.Now()
+	first := (<-scheduler.Ready()).URL
+	second := (<-scheduler.Ready()).URL
+
+	assert.Equal(t, "http://a.com/1", first)
+	assert.Equal(t, "http://a.com/2", second)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestHostScheduler_DifferentHostsDontWait(t *testing.T) {
+	scheduler := NewHostScheduler(Politeness{MinDelay: time.Hour, MaxPerHost: 1}, nil)
+	defer scheduler.Close()
+
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	scheduler.Submit(Task{URL: "http://b.com/1"})
+	received := []string{(<-scheduler.Ready()).URL, (<-scheduler.Ready()).URL}
+	assert.ElementsMatch(t, []string{"http://a.com/1", "http://b.com/1"}, received)
+}
+
+func TestHostScheduler_CapsConcurrencyPerHost(t *testing.T) {
+	scheduler := NewHostScheduler(Politeness{MaxPerHost: 1}, nil)
+	defer scheduler.Close()
+
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	scheduler.Submit(Task{URL: "http://a.com/2"})
+	first := <-scheduler.Ready()
+
+	select {
+	case task := <-scheduler.Ready():
+		t.Fatalf("%s was handed out while %s was still in flight", task.URL, first.URL)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	scheduler.Done(first)
+	assert.Equal(t, "http://a.com/2", (<-scheduler.Ready()).URL)
+}
+
+func TestHostScheduler_CrawlDelay(t *testing.T) {
+	crawlDelay := func(string) time.Duration { return 50 * time.Millisecond }
+	scheduler := NewHostScheduler(Politeness{MaxPerHost: 2}, crawlDelay)
+	defer scheduler.Close()
+
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	scheduler.Submit(Task{URL: "http://a.com/2"})
+	start := time.Now()
+	<-scheduler.Ready()
+	<-scheduler.Ready()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestHostScheduler_MaxPending(t *testing.T) {
+	scheduler := NewHostScheduler(Politeness{MaxPerHost: 1, MaxPending: 2}, nil)
+	defer scheduler.Close()
+
+	// the first one is taken right away, waiting to be handed out
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	scheduler.Submit(Task{URL: "http://a.com/2"})
+	scheduler.Submit(Task{URL: "http://a.com/3"})
+	submitted := make(chan struct{})
+	go func() {
+		scheduler.Submit(Task{URL: "http://a.com/4"})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("a task was taken while two were pending")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	// handing out another task makes room for one more
+	scheduler.Done(<-scheduler.Ready())
+	<-submitted
+	assert.Equal(t, "http://a.com/2", (<-scheduler.Ready()).URL)
+}
+
+func TestHostScheduler_CloseUnblocksSubmit(t *testing.T) {
+	scheduler := NewHostScheduler(Politeness{MaxPending: 1}, nil)
+	scheduler.Submit(Task{URL: "http://a.com/1"})
+	submitted := make(chan struct{})
+	go func() {
+		scheduler.Submit(Task{URL: "http://a.com/2"})
+		close(submitted)
+	}()
+	scheduler.Close()
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Fatal("Submit was still blocked after Close")
+	}
+}
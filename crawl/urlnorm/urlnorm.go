@@ -0,0 +1,250 @@
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrUnsupportedScheme = errors.New("only http and https urls are supported")
+
+// TrailingSlash decides what happens to the trailing slash of a path.
+type TrailingSlash int
+
+const (
+	// TrailingSlashKeep leaves the path as it is
+	TrailingSlashKeep TrailingSlash = iota
+	// TrailingSlashRemove removes it, `/docs/` becomes `/docs`. the root path `/` is kept.
+	TrailingSlashRemove
+	// TrailingSlashAdd adds it to paths whose last segment doesn't look like a file, `/docs` becomes `/docs/`
+	TrailingSlashAdd
+)
+
+// Normalizer turns urls into their canonical form so the same page always gets the same url.
+// Following RFC 3986 it always:
+// - lower cases the scheme and host
+// - removes the default port
+// - removes dot segments
+// - upper cases percent-encodings and decodes the ones of unreserved characters
+// - uses `/` for an empty path
+// the rest is configurable.
+type Normalizer struct {
+	TrailingSlash TrailingSlash
+	// KeepFragment keeps `#fragment`, by default it's dropped since it's the same page
+	KeepFragment bool
+	// SortQuery sorts the query parameters by key
+	SortQuery bool
+	// StripWWW treats www.example.com as example.com
+	StripWWW bool
+}
+
+func DefaultNormalizer() Normalizer {
+	return Normalizer{TrailingSlash: TrailingSlashKeep}
+}
+
+// Resolve resolves the link relative to base as a browser would and normalizes the result.
+func (n Normalizer) Resolve(base, link string) (string, error) {
+	resolved, err := Join(base, link)
+	if err != nil {
+		return "", err
+	}
+	return n.Normalize(resolved)
+}
+
+// Join resolves the link relative to base without normalizing the result,
+// e.g. to find the base url of a page with a `<base href>`.
+func Join(base, link string) (string, error) {
+	baseUrl, err := url.Parse(strings.TrimSpace(base))
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", err
+	}
+	return baseUrl.ResolveReference(ref).String(), nil
+}
+
+// Normalize normalizes an absolute http(s) url.
+func (n Normalizer) Normalize(rawUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return "", err
+	}
+	return n.normalize(u)
+}
+
+func (n Normalizer) normalize(u *url.URL) (string, error) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrUnsupportedScheme
+	}
+	if u.Host == "" {
+		return "", errors.New("url has no host")
+	}
+	u.Host = n.normalizeHost(u.Scheme, u.Host)
+
+	path := normalizeEscapes(u.EscapedPath())
+	path = removeDotSegments(path)
+	if path == "" {
+		path = "/"
+	}
+	path = n.applyTrailingSlash(path)
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return "", err
+	}
+	u.Path = unescaped
+	u.RawPath = path
+
+	u.RawQuery = normalizeEscapes(u.RawQuery)
+	if n.SortQuery {
+		u.RawQuery = sortQuery(u.RawQuery)
+	}
+	// drops a lone `?`
+	u.ForceQuery = false
+
+	if !n.KeepFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String(), nil
+}
+
+func (n Normalizer) normalizeHost(scheme, host string) string {
+	host = strings.ToLower(host)
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// no port
+		hostname, port = host, ""
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	hostname = strings.TrimSuffix(hostname, ".")
+	if n.StripWWW {
+		hostname = strings.TrimPrefix(hostname, "www.")
+	}
+	if port == "" {
+		if strings.Contains(hostname, ":") && !strings.HasPrefix(hostname, "[") {
+			// ipv6 needs its brackets back
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return net.JoinHostPort(strings.Trim(hostname, "[]"), port)
+}
+
+func (n Normalizer) applyTrailingSlash(path string) string {
+	if path == "/" {
+		return path
+	}
+	switch n.TrailingSlash {
+	case TrailingSlashRemove:
+		return strings.TrimRight(path, "/")
+	case TrailingSlashAdd:
+		if strings.HasSuffix(path, "/") {
+			return path
+		}
+		lastSegment := path[strings.LastIndex(path, "/")+1:]
+		if strings.Contains(lastSegment, ".") {
+			return path
+		}
+		return path + "/"
+	default:
+		return path
+	}
+}
+
+// removeDotSegments implements RFC 3986 section 5.2.4.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	output := make([]string, 0)
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				output = append(output, "")
+			}
+		case "..":
+			// the leading empty segment of an absolute path stays
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+			if last {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	result := strings.Join(output, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// normalizeEscapes upper cases the hex digits of percent-encodings and decodes the unreserved characters,
+// reserved characters keep their encoding since they might carry meaning.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(decoded) {
+			b.WriteByte(decoded)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	sort.SliceStable(params, func(i, j int) bool {
+		keyI, _, _ := strings.Cut(params[i], "=")
+		keyJ, _, _ := strings.Cut(params[j], "=")
+		return keyI < keyJ
+	})
+	return strings.Join(params, "&")
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
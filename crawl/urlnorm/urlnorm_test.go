@@ -0,0 +1,198 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizer_Resolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		link     string
+		expected string
+	}{
+		{
+			name:     "absolute path",
+			base:     "https://example.com/docs/page",
+			link:     "/about",
+			expected: "https://example.com/about",
+		},
+		{
+			name:     "relative to the current directory",
+			base:     "https://example.com/docs/page",
+			link:     "other",
+			expected: "https://example.com/docs/other",
+		},
+		{
+			name:     "parent directory",
+			base:     "https://example.com/docs/guides/page",
+			link:     "../api/",
+			expected: "https://example.com/docs/api/",
+		},
+		{
+			name:     "dot segments can't go above the root",
+			base:     "https://example.com/docs/",
+			link:     "../../../about",
+			expected: "https://example.com/about",
+		},
+		{
+			name:     "query only",
+			base:     "https://example.com/search?q=old",
+			link:     "?q=new",
+			expected: "https://example.com/search?q=new",
+		},
+		{
+			name:     "protocol relative link keeps the page scheme",
+			base:     "http://example.com/",
+			link:     "//cdn.example.com/lib",
+			expected: "http://cdn.example.com/lib",
+		},
+		{
+			name:     "absolute link keeps its own scheme and port",
+			base:     "https://example.com/",
+			link:     "http://example.com:8080/page",
+			expected: "http://example.com:8080/page",
+		},
+		{
+			name:     "fragment is dropped",
+			base:     "https://example.com/page",
+			link:     "#section",
+			expected: "https://example.com/page",
+		},
+		{
+			name:     "base with a port",
+			base:     "http://127.0.0.1:8080/a/b",
+			link:     "c",
+			expected: "http://127.0.0.1:8080/a/c",
+		},
+	}
+
+	normalizer := DefaultNormalizer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := normalizer.Resolve(tt.base, tt.link)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		input      string
+		expected   string
+	}{
+		{
+			name:       "case of scheme and host",
+			normalizer: DefaultNormalizer(),
+			input:      "HTTPS://Example.COM/Path",
+			expected:   "https://example.com/Path",
+		},
+		{
+			name:       "default ports",
+			normalizer: DefaultNormalizer(),
+			input:      "http://example.com:80/a?x=1",
+			expected:   "http://example.com/a?x=1",
+		},
+		{
+			name:       "non default port is kept",
+			normalizer: DefaultNormalizer(),
+			input:      "https://example.com:80/",
+			expected:   "https://example.com:80/",
+		},
+		{
+			name:       "empty path",
+			normalizer: DefaultNormalizer(),
+			input:      "https://example.com",
+			expected:   "https://example.com/",
+		},
+		{
+			name:       "dot segments",
+			normalizer: DefaultNormalizer(),
+			input:      "https://example.com/a/./b/../c",
+			expected:   "https://example.com/a/c",
+		},
+		{
+			name:       "percent encoding",
+			normalizer: DefaultNormalizer(),
+			input:      "https://example.com/%7euser/a%2fb?q=%e2%9c%93&r=%41",
+			expected:   "https://example.com/~user/a%2Fb?q=%E2%9C%93&r=A",
+		},
+		{
+			name:       "empty query",
+			normalizer: DefaultNormalizer(),
+			input:      "https://example.com/page?",
+			expected:   "https://example.com/page",
+		},
+		{
+			name:       "ipv6 host",
+			normalizer: DefaultNormalizer(),
+			input:      "http://[::1]:80/page",
+			expected:   "http://[::1]/page",
+		},
+		{
+			name:       "trailing slash removed",
+			normalizer: Normalizer{TrailingSlash: TrailingSlashRemove},
+			input:      "https://example.com/docs/",
+			expected:   "https://example.com/docs",
+		},
+		{
+			name:       "root slash is never removed",
+			normalizer: Normalizer{TrailingSlash: TrailingSlashRemove},
+			input:      "https://example.com/",
+			expected:   "https://example.com/",
+		},
+		{
+			name:       "trailing slash added",
+			normalizer: Normalizer{TrailingSlash: TrailingSlashAdd},
+			input:      "https://example.com/docs",
+			expected:   "https://example.com/docs/",
+		},
+		{
+			name:       "trailing slash isn't added to files",
+			normalizer: Normalizer{TrailingSlash: TrailingSlashAdd},
+			input:      "https://example.com/index.html",
+			expected:   "https://example.com/index.html",
+		},
+		{
+			name:       "sorted query",
+			normalizer: Normalizer{SortQuery: true},
+			input:      "https://example.com/?b=2&a=1",
+			expected:   "https://example.com/?a=1&b=2",
+		},
+		{
+			name:       "fragment kept",
+			normalizer: Normalizer{KeepFragment: true},
+			input:      "https://example.com/page#top",
+			expected:   "https://example.com/page#top",
+		},
+		{
+			name:       "www stripped",
+			normalizer: Normalizer{StripWWW: true},
+			input:      "https://www.example.com/",
+			expected:   "https://example.com/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.normalizer.Normalize(tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestNormalizer_Unsupported(t *testing.T) {
+	normalizer := DefaultNormalizer()
+	_, err := normalizer.Resolve("https://example.com/", "mailto:someone@example.com")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+	_, err = normalizer.Resolve("https://example.com/", "javascript:void(0)")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+	_, err = normalizer.Normalize("/relative")
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package visited
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultBloomCapacity is the amount of urls the first filter of a ScalableBloom is sized for
+	DefaultBloomCapacity = 10000
+	// DefaultFalsePositiveRate is the false positive rate of a ScalableBloom when none is given
+	DefaultFalsePositiveRate = 0.001
+
+	// bloomGrowth is how much bigger every new filter is
+	bloomGrowth = 2
+	// bloomTightening is how much lower the false positive rate of every new filter is,
+	// which keeps the compounded rate under the one asked for
+	bloomTightening = 0.5
+)
+
+// ScalableBloom is a Bloom filter which grows with the amount of urls while keeping its false positive rate,
+// by adding bigger and stricter filters as the previous ones fill up (Almeida et al., Scalable Bloom Filters).
+// a false positive means a url is considered as added while it wasn't, so it's never crawled.
+type ScalableBloom struct {
+	mu       sync.Mutex
+	fpRate   float64
+	capacity int
+	filters  []*bloomFilter
+	count    int
+}
+
+// NewScalableBloom sizes the first filter for capacity urls, fpRate is the false positive rate to stay under.
+func NewScalableBloom(capacity int, fpRate float64) *ScalableBloom {
+	if capacity <= 0 {
+		capacity = DefaultBloomCapacity
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = DefaultFalsePositiveRate
+	}
+	b := &ScalableBloom{fpRate: fpRate, capacity: capacity}
+	b.grow()
+	return b
+}
+
+func (b *ScalableBloom) Add(url string) bool {
+	h1, h2 := bloomHashes(url)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.contains(h1, h2) {
+		return false
+	}
+	last := b.filters[len(b.filters)-1]
+	if last.count >= last.capacity {
+		last = b.grow()
+	}
+	last.add(h1, h2)
+	b.count++
+	return true
+}
+
+func (b *ScalableBloom) Contains(url string) bool {
+	h1, h2 := bloomHashes(url)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.contains(h1, h2)
+}
+
+func (b *ScalableBloom) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var memory int64
+	// a url is a false positive if any of the filters says so
+	allNegative := 1.0
+	for _, filter := range b.filters {
+		memory += int64(len(filter.bits)) * 8
+		allNegative *= 1 - filter.falsePositiveRate()
+	}
+	return Stats{
+		Kind:              KindBloom,
+		Count:             b.count,
+		MemoryBytes:       memory,
+		FalsePositiveRate: 1 - allNegative,
+	}
+}
+
+// contains checks all the filters. b.mu must be held.
+func (b *ScalableBloom) contains(h1, h2 uint64) bool {
+	for _, filter := range b.filters {
+		if filter.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// grow adds a new filter, returning it. b.mu must be held.
+func (b *ScalableBloom) grow() *bloomFilter {
+	i := len(b.filters)
+	capacity := b.capacity * int(math.Pow(bloomGrowth, float64(i)))
+	fpRate := b.fpRate * (1 - bloomTightening) * math.Pow(bloomTightening, float64(i))
+	filter := newBloomFilter(capacity, fpRate)
+	b.filters = append(b.filters, filter)
+	return filter
+}
+
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64
+	k        uint64
+	capacity int
+	count    int
+}
+
+// newBloomFilter sizes the filter for capacity elements at the false positive rate.
+func newBloomFilter(capacity int, fpRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(capacity)*math.Ln2)))
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// the k bit positions come from h1 + i*h2 (Kirsch and Mitzenmacher), mixed again since on a small filter
+// the plain sum modulo m only goes through a few bits when h2 shares a factor with m
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		bit := mix64(h1+i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+func (f *bloomFilter) contains(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		bit := mix64(h1+i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// falsePositiveRate estimates the rate for the elements added so far.
+func (f *bloomFilter) falsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.count)/float64(f.m)), float64(f.k))
+}
+
+// bloomHashes derives the two hashes used for the bit positions from the 64-bit hash of the url.
+func bloomHashes(url string) (uint64, uint64) {
+	h1 := hash(url)
+	// makes h2 independent enough from h1
+	h2 := mix64(h1 + 0x9e3779b97f4a7c15)
+	// never 0 so the k bits aren't all the same one
+	return h1, h2 | 1
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(h uint64) uint64 {
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+var _ Set = (*ScalableBloom)(nil)
@@ -0,0 +1,139 @@
+package visited
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Set remembers the urls a crawl has come across, it must be safe for concurrent usage.
+type Set interface {
+	// Add returns true if the url wasn't in the set, adding it now
+	Add(url string) bool
+	Contains(url string) bool
+	Stats() Stats
+}
+
+// Stats is how much a Set holds and how accurate it is.
+type Stats struct {
+	Kind  string
+	Count int
+	// MemoryBytes is an estimate of the memory used by the set
+	MemoryBytes int64
+	// FalsePositiveRate is the estimated probability for a url never added to be considered as added
+	FalsePositiveRate float64
+}
+
+const (
+	KindExact = "exact"
+	KindHash  = "hash"
+	KindBloom = "bloom"
+)
+
+// New creates a Set of the kind, fpRate is only used by bloom sets.
+func New(kind string, fpRate float64) (Set, error) {
+	switch kind {
+	case KindExact:
+		return NewExactSet(), nil
+	case KindHash:
+		return NewHashSet(), nil
+	case KindBloom:
+		return NewScalableBloom(DefaultBloomCapacity, fpRate), nil
+	}
+	return nil, fmt.Errorf("unknown visited set %q, expected one of %s, %s or %s", kind, KindExact, KindHash, KindBloom)
+}
+
+// ExactSet stores every url as is, it never has false positives.
+type ExactSet struct {
+	mu     sync.Mutex
+	urls   map[string]struct{}
+	memory int64
+}
+
+func NewExactSet() *ExactSet {
+	return &ExactSet{urls: make(map[string]struct{})}
+}
+
+// exactEntryOverhead is roughly what the map spends on an entry on top of the url, string header included
+const exactEntryOverhead = 48
+
+func (s *ExactSet) Add(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.urls[url]; exists {
+		return false
+	}
+	s.urls[url] = struct{}{}
+	s.memory += int64(len(url)) + exactEntryOverhead
+	return true
+}
+
+func (s *ExactSet) Contains(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.urls[url]
+	return exists
+}
+
+func (s *ExactSet) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Kind: KindExact, Count: len(s.urls), MemoryBytes: s.memory}
+}
+
+// HashSet stores the 64-bit hash of the urls instead of the urls themselves,
+// two urls with the same hash are considered the same which is unlikely until billions of urls.
+type HashSet struct {
+	mu     sync.Mutex
+	hashes map[uint64]struct{}
+}
+
+func NewHashSet() *HashSet {
+	return &HashSet{hashes: make(map[uint64]struct{})}
+}
+
+// hashEntryBytes is roughly what the map spends on a single hash
+const hashEntryBytes = 24
+
+func (s *HashSet) Add(url string) bool {
+	h := hash(url)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.hashes[h]; exists {
+		return false
+	}
+	s.hashes[h] = struct{}{}
+	return true
+}
+
+func (s *HashSet) Contains(url string) bool {
+	h := hash(url)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.hashes[h]
+	return exists
+}
+
+func (s *HashSet) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := len(s.hashes)
+	return Stats{
+		Kind:              KindHash,
+		Count:             count,
+		MemoryBytes:       int64(count) * hashEntryBytes,
+		FalsePositiveRate: float64(count) / math.Pow(2, 64),
+	}
+}
+
+func hash(url string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(url))
+	return h.Sum64()
+}
+
+var (
+	_ Set = (*ExactSet)(nil)
+	_ Set = (*HashSet)(nil)
+)
@@ -0,0 +1,89 @@
+package visited
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet_AddAndContains(t *testing.T) {
+	tests := []struct {
+		name string
+		set  Set
+	}{
+		{name: "exact", set: NewExactSet()},
+		{name: "hash", set: NewHashSet()},
+		{name: "bloom", set: NewScalableBloom(10, 0.01)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.False(t, test.set.Contains("https://example.com/a"))
+			assert.True(t, test.set.Add("https://example.com/a"))
+			assert.False(t, test.set.Add("https://example.com/a"))
+			assert.True(t, test.set.Contains("https://example.com/a"))
+
+			// goes over the bloom's initial capacity a few times
+			for i := 0; i < 100; i++ {
+				test.set.Add(fmt.Sprintf("https://example.com/%d", i))
+			}
+			for i := 0; i < 100; i++ {
+				assert.True(t, test.set.Contains(fmt.Sprintf("https://example.com/%d", i)))
+			}
+			stats := test.set.Stats()
+			assert.Equal(t, test.name, stats.Kind)
+			assert.Positive(t, stats.MemoryBytes)
+			// a few urls might be false positives for the bloom
+			assert.InDelta(t, 101, stats.Count, 3)
+		})
+	}
+}
+
+func TestScalableBloom_FalsePositiveRate(t *testing.T) {
+	bloom := NewScalableBloom(1000, 0.01)
+	exact := NewExactSet()
+	for i := 0; i < 20000; i++ {
+		bloom.Add(fmt.Sprintf("https://example.com/page/%d", i))
+		exact.Add(fmt.Sprintf("https://example.com/page/%d", i))
+	}
+	assert.Len(t, bloom.filters, 5)
+
+	falsePositives := 0
+	for i := 0; i < 20000; i++ {
+		if bloom.Contains(fmt.Sprintf("https://example.com/other/%d", i)) {
+			falsePositives++
+		}
+	}
+	measured := float64(falsePositives) / 20000
+	stats := bloom.Stats()
+	assert.Less(t, measured, 0.01)
+	assert.Less(t, stats.FalsePositiveRate, 0.01)
+	assert.InDelta(t, stats.FalsePositiveRate, measured, 0.005)
+	// a lot less than storing the urls
+	assert.Less(t, stats.MemoryBytes*10, exact.Stats().MemoryBytes)
+}
+
+func TestScalableBloom_FalsePositiveRate_SmallFilters(t *testing.T) {
+	// the first filters are a few dozen bits, where the bit positions must still be spread out
+	falsePositives := 0
+	for i := 0; i < 5000; i++ {
+		bloom := NewScalableBloom(2, 0.01)
+		for j := 0; j < 6; j++ {
+			bloom.Add(fmt.Sprintf("https://example.com:%d/page/%d", i, j))
+		}
+		if bloom.Contains(fmt.Sprintf("https://example.com:%d/other", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/5000, 0.01)
+}
+
+func TestNew(t *testing.T) {
+	set, err := New(KindBloom, 0.05)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.05, set.(*ScalableBloom).fpRate)
+
+	_, err = New("nope", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"spiderman/crawl"
+	"spiderman/crawl/filters"
+	"spiderman/publish"
+	"sync"
+)
+
+// runDryRun crawls as usual, only the seeds unless told otherwise by -max-depth,
+// and writes which rule or filter accepted or rejected each link found instead of the results.
+func runDryRun(ctx context.Context, input string, opts []crawl.Option) int {
+	publisher := &dryRunPublisher{ctx: ctx, w: os.Stdout}
+	publisher.crawler = crawl.NewCrawler(input, publisher, opts...)
+	err := publisher.crawler.CrawlContext(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "[Error]: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// dryRunPublisher writes the links of each page along with the decision of the crawler about them.
+type dryRunPublisher struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	w       io.Writer
+	crawler *crawl.Crawler
+}
+
+func (p *dryRunPublisher) Publish(pageUrl string, _ []string, meta publish.Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := fmt.Fprintf(p.w, "%s (%d links)\n", pageUrl, len(meta.Links)); err != nil {
+		return err
+	}
+	for _, link := range meta.Links {
+		if _, err := fmt.Fprintf(p.w, "  %s\n", p.decide(link)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decide describes what the crawler makes of the link, going through the rules and then every filter
+// e.g. the scope and robots.txt, the reason is the filter which rejected it or else the rule which decided.
+func (p *dryRunPublisher) decide(link publish.Link) string {
+	decision := p.crawler.Explain(p.ctx, link.URL)
+	verdict := "reject"
+	if decision.Crawlable {
+		verdict = "accept"
+	}
+	reason := "no rule matched"
+	switch {
+	case decision.Filter != nil:
+		reason = filters.Describe(decision.Filter)
+	case decision.Rule != nil:
+		reason = decision.Rule.String()
+	case !decision.Crawlable:
+		reason = "no include rule matched"
+	}
+	return fmt.Sprintf("%s  %s (%s)", verdict, link.URL, reason)
+}
+
+func (p *dryRunPublisher) PublishStats(publish.Summary) error {
+	return nil
+}
+
+func (p *dryRunPublisher) RecordError(url string, failedFor publish.ErrType, err error, _ publish.Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, writeErr := fmt.Fprintf(p.w, "%s [%s]: %v\n", url, failedFor, err)
+	return writeErr
+}
+
+func (p *dryRunPublisher) PublishRedirects([]publish.Redirect) error {
+	return nil
+}
+
+var _ publish.Publisher = (*dryRunPublisher)(nil)
@@ -1,56 +1,369 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net/url"
 	"os"
+	"os/signal"
 	"spiderman/crawl"
+	"spiderman/crawl/filters"
+	"spiderman/crawl/visited"
 	"spiderman/publish"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	usage = "Usage: spider [check] [flags] <base_website_link> [num_workers]\n" +
+		"  check also checks the external links, reporting the broken links and exiting with 1 if there are any"
+	defaultCheckpoint = "spider-checkpoint.json"
+	formatText        = "text"
+	formatJSONL       = "jsonl"
+	formatCSV         = "csv"
+	formatTSV         = "tsv"
+	formatDOT         = "dot"
+	formatGraphML     = "graphml"
+	formatGEXF        = "gexf"
+	formatSitemap     = "sitemap"
+	// frontierSegmentSize is the amount of urls per file when spilling the frontier to disk
+	frontierSegmentSize = 10000
 )
 
 func main() {
-	input, numWorkers := sanitizeInputs()
+	var budget crawl.Budget
+	flag.IntVar(&budget.MaxPages, "max-pages", 0, "stop after crawling this many pages, 0 for no limit")
+	flag.IntVar(&budget.MaxPagesPerHost, "max-pages-per-host", 0, "crawl at most this many pages of a single host, 0 for no limit")
+	flag.Int64Var(&budget.MaxBytes, "max-bytes", 0, "stop after downloading this many bytes, 0 for no limit")
+	flag.DurationVar(&budget.MaxDuration, "max-duration", 0, "stop after crawling for this long e.g. 10m, 0 for no limit")
+	maxDepth := flag.Int("max-depth", -1, "don't follow links deeper than this from the seed, negative for no limit")
+	checkpoint := crawl.Checkpoint{Interval: 30 * time.Second}
+	flag.StringVar(&checkpoint.Path, "checkpoint", "", "save the progress of the crawl to this file so it can be resumed")
+	flag.DurationVar(&checkpoint.Interval, "checkpoint-interval", checkpoint.Interval, "how often the progress is saved")
+	flag.BoolVar(&checkpoint.Resume, "resume", false, "pick up the crawl saved in the checkpoint file, "+defaultCheckpoint+" if -checkpoint isn't set")
+	frontierDir := flag.String("frontier-dir", "", "spill the queued urls to this directory instead of keeping them all in memory, -checkpoint still keeps them in memory too")
+	visitedKind := flag.String("visited", visited.KindExact, "how urls are deduplicated: exact, hash (64-bit hashes) or bloom (scalable Bloom filter), -checkpoint still keeps every url as is")
+	var out output
+	flag.StringVar(&out.formats, "format", formatText, "output format: text, jsonl (one JSON object per page, error and redirect, then the stats), "+
+		"csv or tsv (edge list of the links), dot, graphml or gexf (link graph) or sitemap (sitemap.xml files). "+
+		"several can be comma separated, each written to stdout or to a file with format=path e.g. text,jsonl=crawl.jsonl")
+	flag.StringVar(&out.nodesPath, "nodes", "", "with csv or tsv, also write the crawled pages and their status to this file")
+	flag.IntVar(&out.graph.ClusterDepth, "cluster-depth", 0, "with dot, graphml or gexf, group the pages by their first n path segments, 0 for no clustering")
+	flag.StringVar(&out.graph.SpillDir, "graph-dir", "", "with dot, graphml or gexf, keep the links in a file of this directory instead of memory")
+	flag.StringVar(&out.sitemap.Dir, "sitemap-dir", ".", "with sitemap, the directory the files are written to")
+	flag.StringVar(&out.sitemap.BaseURL, "sitemap-base-url", "", "with sitemap, where the files are served from, the origin of the seed by default")
+	flag.BoolVar(&out.sitemap.Gzip, "sitemap-gzip", false, "with sitemap, gzip the files")
+	var async publish.AsyncOptions
+	flag.IntVar(&async.BufferSize, "async-buffer", 0, "publish from a goroutine of its own through a buffer of this many events, 0 to publish from the workers")
+	asyncOverflow := flag.String("async-overflow", string(publish.OverflowBlock), "with -async-buffer, what to do when the buffer is full: block (wait for room) or drop (leave the event out)")
+	bloomFpRate := flag.Float64("bloom-fp-rate", visited.DefaultFalsePositiveRate, "false positive rate of the bloom visited set")
+	seeds := flag.String("seeds", "", "comma separated urls to start from along with the one given, e.g. the docs and blog of the site")
+	scope := flag.String("scope", "", "comma separated hosts the crawl stays within, *.example.com for any subdomain of example.com, the hosts of the seeds by default")
+	scopeMode := flag.String("scope-mode", string(filters.ScopeHostWWW), "without -scope, how far from the hosts of the seeds the crawl goes: "+
+		"host-www (the same host with or without www.), host (exactly the same host and port), domain (the same registrable domain e.g. blog.example.co.uk for example.co.uk) or subdomains (the hosts and their subdomains)")
+	userAgent := flag.String("user-agent", "", "User-Agent header of the requests, the robots.txt rules are picked by its product token e.g. mybot for MyBot/1.0")
+	var includes, excludes patterns
+	flag.Var(&includes, "include", "only crawl the urls matching this glob or regex, e.g. glob:/docs/** or re:^https://docs\\., can be repeated")
+	flag.Var(&excludes, "exclude", "don't crawl the urls matching this glob or regex, e.g. glob:/admin/** or re:/search\\?q=, can be repeated")
+	rulesPath := flag.String("rules", "", "file of include and exclude rules, one per line e.g. \"exclude glob:/admin/**\", combined with -include and -exclude")
+	dryRun := flag.Bool("dry-run", false, "only crawl the seeds, or down to -max-depth, and write which rule or filter accepted or rejected each link found")
+	checkWorkers := flag.Int("check-workers", crawl.DefaultCheckWorkers, "with check, how many external links are checked at once")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	args := os.Args[1:]
+	checkMode := len(args) > 0 && args[0] == "check"
+	if checkMode {
+		args = args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
+	input, numWorkers := sanitizeInputs(flag.Args())
+	if checkpoint.Resume && checkpoint.Path == "" {
+		checkpoint.Path = defaultCheckpoint
+	}
+	out.resume = checkpoint.Resume
+	if out.sitemap.BaseURL == "" {
+		// the seed was already validated
+		seed, _ := url.Parse(input)
+		out.sitemap.BaseURL = seed.Scheme + "://" + seed.Host
+	}
+
+	// Ctrl-C stops the crawl gracefully, the stats of what was crawled are still printed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	crawler := crawl.NewCrawler(input, publish.NewConsolePublisher())
-	var err error
-	if numWorkers == 1 {
-		err = crawler.Crawl()
+	opts := []crawl.Option{
+		crawl.WithWorkers(numWorkers),
+		crawl.WithBudget(budget),
+		crawl.WithMaxDepth(*maxDepth),
+		crawl.WithCheckpoint(checkpoint),
+	}
+	if *userAgent != "" {
+		opts = append(opts, crawl.WithUserAgent(*userAgent))
+	}
+	if *seeds != "" {
+		extra := strings.Split(*seeds, ",")
+		for i, seed := range extra {
+			extra[i] = strings.TrimSpace(seed)
+			if !IsValidHTTPLink(extra[i]) {
+				fmt.Printf("Not a valid seed %q\n", seed)
+				os.Exit(1)
+			}
+		}
+		opts = append(opts, crawl.WithSeeds(extra...))
+	}
+	if *scope != "" {
+		scopeFilter, err := filters.NewScope(strings.Split(*scope, ",")...)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		opts = append(opts, crawl.WithScope(scopeFilter))
 	} else {
-		err = crawler.CrawlParallel(numWorkers) // use the optional argument here
+		// the mode is validated on the seed given
+		if _, err := filters.ScopeOf(filters.ScopeMode(*scopeMode), input); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		opts = append(opts, crawl.WithScopeMode(filters.ScopeMode(*scopeMode)))
+	}
+	if _, err := visited.New(*visitedKind, *bloomFpRate); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	opts = append(opts, crawl.WithVisitedSet(func() visited.Set {
+		set, _ := visited.New(*visitedKind, *bloomFpRate)
+		return set
+	}))
+	if checkpoint.Path != "" && (*frontierDir != "" || *visitedKind != visited.KindExact) {
+		log.Printf("[Warning] the checkpoint keeps every queued and seen url in memory, whatever -frontier-dir and -visited\n")
+	}
+	if *frontierDir != "" {
+		opts = append(opts, crawl.WithFrontier(func() (crawl.Frontier, error) {
+			return crawl.NewDiskFrontier(*frontierDir, frontierSegmentSize)
+		}))
+	}
+	rules, err := loadRules(*rulesPath, includes, excludes)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !rules.Empty() {
+		opts = append(opts, crawl.WithRules(rules))
+	}
+	if *dryRun {
+		if *maxDepth < 0 {
+			opts = append(opts, crawl.WithMaxDepth(0))
+		}
+		os.Exit(runDryRun(ctx, input, opts))
+	}
+	if checkMode {
+		os.Exit(runCheck(ctx, input, *checkWorkers, out.formats, opts))
+	}
+	publisher, closePublisher, err := newPublisher(out)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer closePublisher()
+	if async.BufferSize > 0 {
+		async.Overflow = publish.OverflowPolicy(*asyncOverflow)
+		if async.Overflow != publish.OverflowBlock && async.Overflow != publish.OverflowDrop {
+			fmt.Printf("unknown async overflow %q, expected %s or %s\n", async.Overflow, publish.OverflowBlock, publish.OverflowDrop)
+			os.Exit(1)
+		}
+		publisher = publish.NewAsyncPublisher(publisher, async)
+	}
+	err = crawl.NewCrawler(input, publisher, opts...).CrawlContext(ctx)
+	// written to stderr so they don't end up in the results
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Spider was interrupted, results are partial")
+		return
 	}
 	if err != nil {
-		fmt.Println("Spider had issues spidering")
-		fmt.Printf("[Error]: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Spider had issues spidering")
+		fmt.Fprintf(os.Stderr, "[Error]: %v\n", err)
 		return
 	}
 }
 
-func sanitizeInputs() (string, int) {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: spider <base_website_link> [num_workers::optional]")
+// patterns is a flag which can be repeated.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// loadRules reads the rules file if any along with the rules of the flags.
+func loadRules(path string, includes, excludes []string) (*filters.Rules, error) {
+	rules := make([]filters.Rule, 0)
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open rules file: %w", err)
+		}
+		defer file.Close()
+		rules, err = filters.ParseRules(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+		}
+	}
+	for _, flagged := range []struct {
+		include  bool
+		patterns []string
+	}{{true, includes}, {false, excludes}} {
+		for _, pattern := range flagged.patterns {
+			rule, err := filters.NewRule(flagged.include, pattern)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return filters.NewRules(rules...), nil
+}
+
+// output is where and how the results of the crawl are written.
+type output struct {
+	// formats are comma separated, each written to stdout or to the file after "=" e.g. "text,jsonl=crawl.jsonl"
+	formats string
+	// nodesPath is where the node list of the edge list formats goes, if anywhere
+	nodesPath string
+	// resume appends to the files instead of truncating them, so what was written up to the last checkpoint is kept
+	resume  bool
+	graph   publish.GraphOptions
+	sitemap publish.SitemapOptions
+}
+
+// newPublisher returns the publisher writing every format of the output, along with what releases it once the crawl is over.
+func newPublisher(out output) (publish.Publisher, func(), error) {
+	publishers := make([]publish.Publisher, 0)
+	closers := make([]func(), 0)
+	release := func() {
+		for _, closeFile := range closers {
+			closeFile()
+		}
+	}
+	toStdout := ""
+	for _, entry := range strings.Split(out.formats, ",") {
+		format, path, toFile := strings.Cut(strings.TrimSpace(entry), "=")
+		var w io.Writer = os.Stdout
+		switch {
+		case format == formatSitemap:
+			// it writes files of its own, in the directory given instead
+			if toFile {
+				out.sitemap.Dir = path
+			}
+		case toFile:
+			file, err := createOutput(path, out.resume && isStreamed(format))
+			if err != nil {
+				release()
+				return nil, nil, fmt.Errorf("failed to create %s file: %w", format, err)
+			}
+			closers = append(closers, func() { _ = file.Close() })
+			w = file
+		case toStdout != "":
+			release()
+			return nil, nil, fmt.Errorf("%s and %s can't both be written to stdout, write one to a file e.g. %s=out.%s", toStdout, format, format, format)
+		default:
+			toStdout = format
+		}
+		publisher, closePublisher, err := newFormatPublisher(format, w, out)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		publishers = append(publishers, publisher)
+		closers = append(closers, closePublisher)
+	}
+	if len(publishers) == 1 {
+		return publishers[0], release, nil
+	}
+	return publish.Multi(publishers...), release, nil
+}
+
+// createOutput creates the file, or opens it for appending when resuming.
+func createOutput(path string, resume bool) (*os.File, error) {
+	if resume {
+		return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	}
+	return os.Create(path)
+}
+
+// isStreamed tells whether the format is written along the way, rather than as a whole document once the crawl is over
+// which can't be appended to.
+func isStreamed(format string) bool {
+	return format == formatText || format == formatJSONL || format == formatCSV || format == formatTSV
+}
+
+// newFormatPublisher returns the publisher writing the format to w, along with what releases it once the crawl is over.
+func newFormatPublisher(format string, w io.Writer, out output) (publish.Publisher, func(), error) {
+	noop := func() {}
+	switch format {
+	case formatText:
+		return publish.NewConsolePublisherTo(w), noop, nil
+	case formatJSONL:
+		return publish.NewJSONLPublisher(w), noop, nil
+	case formatCSV, formatTSV:
+		newEdgeList := publish.NewCSVEdgeListPublisher
+		if format == formatTSV {
+			newEdgeList = publish.NewTSVEdgeListPublisher
+		}
+		if out.nodesPath == "" {
+			return newEdgeList(w, nil), noop, nil
+		}
+		nodes, err := createOutput(out.nodesPath, out.resume)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create nodes file: %w", err)
+		}
+		return newEdgeList(w, nodes), func() { _ = nodes.Close() }, nil
+	case formatDOT, formatGraphML, formatGEXF:
+		out.graph.Format = publish.GraphFormat(format)
+		publisher, err := publish.NewGraphPublisher(w, out.graph)
+		return publisher, noop, err
+	case formatSitemap:
+		return publish.NewSitemapPublisher(out.sitemap), noop, nil
+	}
+	return nil, nil, fmt.Errorf("unknown format %q, expected one of %s", format,
+		strings.Join([]string{formatText, formatJSONL, formatCSV, formatTSV, formatDOT, formatGraphML, formatGEXF, formatSitemap}, ", "))
+}
+
+func sanitizeInputs(args []string) (string, int) {
+	if len(args) < 1 {
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
-	input := os.Args[1]
+	input := args[0]
 	// validate input
 	input = strings.TrimSpace(input)
 	if input == "" {
-		fmt.Println("Usage: spider <base_website_link> [num_workers]")
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
 	valid := IsValidHTTPLink(input)
 	if !valid {
-		fmt.Println("Not a valid link \nUsage: spider <base_website_link> [num_workers]")
+		fmt.Println("Not a valid link \n" + usage)
 		os.Exit(1)
 	}
 
 	// default number of workers
 	numWorkers := 20
-	if len(os.Args) >= 3 {
-		n, err := strconv.Atoi(os.Args[2])
+	if len(args) >= 2 {
+		n, err := strconv.Atoi(args[1])
 		if err != nil || n <= 0 {
 			fmt.Println("num_workers must be a positive integer")
 			os.Exit(1)
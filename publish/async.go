@@ -0,0 +1,230 @@
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPublisherClosed is returned for the events which come after PublishStats.
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// OverflowPolicy is what an async publisher does with an event when its buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes the crawl wait for room in the buffer, no event is lost
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDrop leaves out the events which don't fit, the crawl never waits on the publisher
+	OverflowDrop OverflowPolicy = "drop"
+
+	// DefaultAsyncBufferSize is the amount of events an async publisher buffers when no size is given
+	DefaultAsyncBufferSize = 1024
+)
+
+// AsyncOptions configures an async publisher.
+type AsyncOptions struct {
+	// BufferSize is the amount of events waiting to be published, DefaultAsyncBufferSize when 0
+	BufferSize int
+	// Overflow is what happens to events when the buffer is full, OverflowBlock when empty
+	Overflow OverflowPolicy
+}
+
+// AsyncStats is how the buffer of an async publisher fared.
+type AsyncStats struct {
+	BufferSize int `json:"buffer_size"`
+	// Queued is the amount of events currently waiting in the buffer
+	Queued int `json:"queued"`
+	// MaxQueued is the most events which waited in the buffer at once
+	MaxQueued int `json:"max_queued"`
+	// Published is the amount of events handed to the wrapped publisher, failed ones included
+	Published int64 `json:"published"`
+	// Dropped is the amount of events left out for the buffer being full
+	Dropped int64 `json:"dropped"`
+	// Failed is the amount of events the wrapped publisher returned an error for
+	Failed int64 `json:"failed"`
+}
+
+type asyncEvent struct {
+	publish func(p Publisher) error
+	// flushed is closed once the events before it were published, set for flushes only
+	flushed chan struct{}
+	// stop makes the writer return after the flush
+	stop bool
+}
+
+// AsyncPublisher hands the events over to a goroutine which publishes them to the wrapped publisher,
+// so a slow sink doesn't hold up the crawl. the events are published in the order they were received.
+// PublishStats waits for the buffered events to be published, then publishes the stats along with the ones of the buffer.
+type AsyncPublisher struct {
+	next     Publisher
+	overflow OverflowPolicy
+	events   chan asyncEvent
+	// done is closed once the writer returned
+	done chan struct{}
+	// mu is held for reading while sending events, closing takes it for writing so no event is sent afterward
+	mu     sync.RWMutex
+	closed bool
+
+	maxQueued atomic.Int64
+	published atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+	// firstErr is the first error of the wrapped publisher, returned by PublishStats
+	errMu    sync.Mutex
+	firstErr error
+}
+
+// NewAsyncPublisher wraps next so it's published to from a goroutine of its own, its writer is started right away.
+func NewAsyncPublisher(next Publisher, options AsyncOptions) *AsyncPublisher {
+	if options.BufferSize <= 0 {
+		options.BufferSize = DefaultAsyncBufferSize
+	}
+	if options.Overflow == "" {
+		options.Overflow = OverflowBlock
+	}
+	a := &AsyncPublisher{
+		next:     next,
+		overflow: options.Overflow,
+		events:   make(chan asyncEvent, options.BufferSize),
+		done:     make(chan struct{}),
+	}
+	go a.write()
+	return a
+}
+
+func (a *AsyncPublisher) Publish(title string, lines []string, meta Meta) error {
+	return a.enqueue(func(p Publisher) error { return p.Publish(title, lines, meta) })
+}
+
+func (a *AsyncPublisher) RecordError(url string, failedFor ErrType, err error, meta Meta) error {
+	return a.enqueue(func(p Publisher) error { return p.RecordError(url, failedFor, err, meta) })
+}
+
+func (a *AsyncPublisher) PublishRedirects(chain []Redirect) error {
+	return a.enqueue(func(p Publisher) error { return p.PublishRedirects(chain) })
+}
+
+// PublishStats waits for the buffered events to be published, then publishes the stats to the wrapped publisher
+// with the ones of the buffer in summary.Async. the error of the first event which failed is returned along with its own.
+func (a *AsyncPublisher) PublishStats(summary Summary) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrPublisherClosed
+	}
+	a.closed = true
+	a.mu.Unlock()
+	// nothing else is sent anymore, the writer stops once it went through what's buffered
+	a.events <- asyncEvent{flushed: make(chan struct{}), stop: true}
+	<-a.done
+
+	stats := a.Stats()
+	summary.Async = &stats
+	err := a.next.PublishStats(summary)
+	a.errMu.Lock()
+	defer a.errMu.Unlock()
+	if a.firstErr != nil {
+		err = errors.Join(fmt.Errorf("%d events failed to publish, the first one: %w", stats.Failed, a.firstErr), err)
+	}
+	return err
+}
+
+// Flush waits for the events received so far to be published.
+func (a *AsyncPublisher) Flush() error {
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrPublisherClosed
+	}
+	flushed := make(chan struct{})
+	a.events <- asyncEvent{flushed: flushed}
+	a.mu.RUnlock()
+	<-flushed
+	return nil
+}
+
+// Stats returns how the buffer fared so far.
+func (a *AsyncPublisher) Stats() AsyncStats {
+	return AsyncStats{
+		BufferSize: cap(a.events),
+		Queued:     len(a.events),
+		MaxQueued:  int(a.maxQueued.Load()),
+		Published:  a.published.Load(),
+		Dropped:    a.dropped.Load(),
+		Failed:     a.failed.Load(),
+	}
+}
+
+// Progress flushes the buffer so the progress of the wrapped publisher includes every event received so far.
+// it's nil when the wrapped publisher isn't Resumable.
+func (a *AsyncPublisher) Progress() ([]byte, error) {
+	resumable, ok := a.next.(Resumable)
+	if !ok {
+		return nil, nil
+	}
+	if err := a.Flush(); err != nil {
+		return nil, err
+	}
+	return resumable.Progress()
+}
+
+func (a *AsyncPublisher) Restore(progress []byte) error {
+	if resumable, ok := a.next.(Resumable); ok {
+		return resumable.Restore(progress)
+	}
+	return nil
+}
+
+func (a *AsyncPublisher) enqueue(publish func(p Publisher) error) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrPublisherClosed
+	}
+	event := asyncEvent{publish: publish}
+	if a.overflow == OverflowDrop {
+		select {
+		case a.events <- event:
+		default:
+			a.dropped.Add(1)
+			return nil
+		}
+	} else {
+		a.events <- event
+	}
+	queued := int64(len(a.events))
+	for {
+		max := a.maxQueued.Load()
+		if queued <= max || a.maxQueued.CompareAndSwap(max, queued) {
+			return nil
+		}
+	}
+}
+
+// write publishes the events to the wrapped publisher until it's stopped.
+func (a *AsyncPublisher) write() {
+	defer close(a.done)
+	for event := range a.events {
+		if event.flushed != nil {
+			close(event.flushed)
+			if event.stop {
+				return
+			}
+			continue
+		}
+		if err := event.publish(a.next); err != nil {
+			a.failed.Add(1)
+			a.errMu.Lock()
+			if a.firstErr == nil {
+				a.firstErr = err
+			}
+			a.errMu.Unlock()
+		}
+		a.published.Add(1)
+	}
+}
+
+var _ Publisher = (*AsyncPublisher)(nil)
+var _ Resumable = (*AsyncPublisher)(nil)
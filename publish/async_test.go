@@ -0,0 +1,104 @@
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedPublisher is a TestPublisher which publishes pages only once the gate is opened.
+type gatedPublisher struct {
+	*TestPublisher
+	gate chan struct{}
+}
+
+func (g *gatedPublisher) Publish(title string, lines []string, meta Meta) error {
+	<-g.gate
+	return g.TestPublisher.Publish(title, lines, meta)
+}
+
+func TestAsyncPublisher_Overflow(t *testing.T) {
+	tests := []struct {
+		overflow          OverflowPolicy
+		expectedPublished int
+		expectedDropped   int64
+	}{
+		// the first page is held by the writer, two wait in the buffer and the others don't fit
+		{overflow: OverflowDrop, expectedPublished: 3, expectedDropped: 7},
+		{overflow: OverflowBlock, expectedPublished: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.overflow), func(t *testing.T) {
+			next := &gatedPublisher{TestPublisher: NewTestPublisher(), gate: make(chan struct{})}
+			publisher := NewAsyncPublisher(next, AsyncOptions{BufferSize: 2, Overflow: test.overflow})
+
+			published := make(chan struct{})
+			go func() {
+				defer close(published)
+				for i := 0; i < 10; i++ {
+					assert.NoError(t, publisher.Publish(fmt.Sprintf("https://example.com/%d", i), nil, Meta{}))
+					if i == 0 {
+						// lets the writer pick it up so it's the one held at the gate
+						assert.Eventually(t, func() bool { return publisher.Stats().Queued == 0 }, time.Second, time.Millisecond)
+					}
+				}
+			}()
+			select {
+			case <-published:
+				assert.Equal(t, OverflowDrop, test.overflow, "publishing didn't wait for the sink")
+			case <-time.After(50 * time.Millisecond):
+				assert.Equal(t, OverflowBlock, test.overflow, "publishing waited for the sink")
+			}
+			close(next.gate)
+			<-published
+			assert.NoError(t, publisher.PublishStats(Summary{StopReason: "max pages of 10"}))
+
+			assert.Len(t, next.Published, test.expectedPublished)
+			for i, url := range next.Published {
+				assert.Equal(t, fmt.Sprintf("https://example.com/%d", i), url, "out of order")
+			}
+			assert.Equal(t, &Summary{StopReason: "max pages of 10", Async: &AsyncStats{
+				BufferSize: 2,
+				MaxQueued:  2,
+				Published:  int64(test.expectedPublished),
+				Dropped:    test.expectedDropped,
+			}}, next.Summary)
+		})
+	}
+}
+
+func TestAsyncPublisher_Errors(t *testing.T) {
+	down := errors.New("sink is down")
+	publisher := NewAsyncPublisher(failingPublisher{err: down}, AsyncOptions{})
+
+	assert.NoError(t, publisher.Publish("https://example.com/", nil, Meta{}))
+	assert.NoError(t, publisher.PublishRedirects([]Redirect{{URL: "https://example.com/old", StatusCode: 301}}))
+	err := publisher.PublishStats(Summary{})
+	assert.ErrorIs(t, err, down)
+	assert.ErrorContains(t, err, "2 events failed to publish")
+
+	assert.ErrorIs(t, publisher.Publish("https://example.com/late", nil, Meta{}), ErrPublisherClosed)
+	assert.ErrorIs(t, publisher.PublishStats(Summary{}), ErrPublisherClosed)
+}
+
+func TestAsyncPublisher_ProgressIncludesBufferedEvents(t *testing.T) {
+	next := NewConsolePublisherTo(&bytes.Buffer{})
+	publisher := NewAsyncPublisher(next, AsyncOptions{BufferSize: 100})
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, publisher.Publish(fmt.Sprintf("https://example.com/%d", i), []string{"https://example.com/"}, Meta{}))
+	}
+
+	progress, err := publisher.Progress()
+	assert.NoError(t, err)
+	assert.Contains(t, string(progress), `"total_pages":50`)
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+
+	progress, err = NewAsyncPublisher(NewTestPublisher(), AsyncOptions{}).Progress()
+	assert.NoError(t, err)
+	assert.Nil(t, progress, "not resumable")
+}
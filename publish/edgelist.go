@@ -0,0 +1,217 @@
+package publish
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+var (
+	edgeHeader = []string{"source", "target", "anchor_text", "rel", "is_internal", "target_status"}
+	nodeHeader = []string{"url", "status", "content_type", "depth", "parent", "outgoing_links"}
+)
+
+// edgeListPublisher writes the links between pages as an edge list, and the pages themselves as a node list.
+// both are written as the pages are published, the target status of an edge is the one known by then
+// i.e. when the target was published, failed or redirected before the page linking to it. the node list
+// has the status of every url, the redirecting ones included.
+type edgeListPublisher struct {
+	mu           sync.Mutex
+	edgesOut     *streamOutput
+	edges        *csv.Writer
+	edgesStarted bool
+	// nodes is nil when no node list is written
+	nodesOut     *streamOutput
+	nodes        *csv.Writer
+	nodesStarted bool
+	// statuses are the status codes of the urls published so far
+	statuses map[string]int
+}
+
+// NewCSVEdgeListPublisher writes an edge per link to edges and a node per page to nodes, which can be nil, as CSV.
+func NewCSVEdgeListPublisher(edges io.Writer, nodes io.Writer) Publisher {
+	return newEdgeListPublisher(edges, nodes, ',')
+}
+
+// NewTSVEdgeListPublisher is NewCSVEdgeListPublisher writing tab separated values.
+func NewTSVEdgeListPublisher(edges io.Writer, nodes io.Writer) Publisher {
+	return newEdgeListPublisher(edges, nodes, '\t')
+}
+
+func newEdgeListPublisher(edges io.Writer, nodes io.Writer, delimiter rune) *edgeListPublisher {
+	p := &edgeListPublisher{
+		edgesOut: newStreamOutput(edges),
+		statuses: make(map[string]int),
+	}
+	p.edges = csv.NewWriter(p.edgesOut)
+	p.edges.Comma = delimiter
+	if nodes != nil {
+		p.nodesOut = newStreamOutput(nodes)
+		p.nodes = csv.NewWriter(p.nodesOut)
+		p.nodes.Comma = delimiter
+	}
+	return p
+}
+
+func (p *edgeListPublisher) Publish(title string, lines []string, meta Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordStatus(title, meta.StatusCode)
+	if err := p.startEdges(); err != nil {
+		return err
+	}
+	for _, link := range meta.Links {
+		status := ""
+		if code, known := p.statuses[link.URL]; known {
+			status = strconv.Itoa(code)
+		}
+		if err := p.edges.Write([]string{title, link.URL, link.AnchorText, link.Rel, strconv.FormatBool(link.Internal), status}); err != nil {
+			return err
+		}
+	}
+	if err := p.writeNode(title, meta, len(lines)); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (p *edgeListPublisher) RecordError(url string, _ ErrType, _ error, meta Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordStatus(url, meta.StatusCode)
+	if err := p.writeNode(url, meta, 0); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+// PublishRedirects writes the redirecting urls to the node list along with their status,
+// the url the chain ends up at is written once it's published.
+// links to them found afterward get it as their target status.
+func (p *edgeListPublisher) PublishRedirects(chain []Redirect) error {
+	if len(chain) < 2 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, hop := range chain[:len(chain)-1] {
+		p.recordStatus(hop.URL, hop.StatusCode)
+		if err := p.writeNode(hop.URL, Meta{StatusCode: hop.StatusCode}, 0); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+func (p *edgeListPublisher) PublishStats(_ Summary) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// the headers are there even when no page was published
+	if err := p.startEdges(); err != nil {
+		return err
+	}
+	if p.nodes != nil {
+		if err := p.startNodes(); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+// edgeListProgress is the part of edgeListPublisher which is saved in checkpoints,
+// so the headers aren't written again in the middle of the files a resumed crawl appends to.
+type edgeListProgress struct {
+	EdgesStarted bool `json:"edges_started"`
+	NodesStarted bool `json:"nodes_started"`
+	// EdgesLength and NodesLength are the lengths of the files, cut back to them when resuming
+	EdgesLength *int64 `json:"edges_length,omitempty"`
+	NodesLength *int64 `json:"nodes_length,omitempty"`
+}
+
+func (p *edgeListPublisher) Progress() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	progress := edgeListProgress{EdgesStarted: p.edgesStarted, NodesStarted: p.nodesStarted, EdgesLength: &p.edgesOut.length}
+	if p.nodes != nil {
+		progress.NodesLength = &p.nodesOut.length
+	}
+	return json.Marshal(progress)
+}
+
+func (p *edgeListPublisher) Restore(progress []byte) error {
+	restored := edgeListProgress{}
+	if err := json.Unmarshal(progress, &restored); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.edgesOut.truncate(restored.EdgesLength); err != nil {
+		return fmt.Errorf("failed to truncate the edges: %w", err)
+	}
+	if p.nodes != nil {
+		if err := p.nodesOut.truncate(restored.NodesLength); err != nil {
+			return fmt.Errorf("failed to truncate the nodes: %w", err)
+		}
+	}
+	p.edgesStarted, p.nodesStarted = restored.EdgesStarted, restored.NodesStarted
+	return nil
+}
+
+// recordStatus keeps the status of the url for the edges written afterward. p.mu must be held.
+func (p *edgeListPublisher) recordStatus(url string, statusCode int) {
+	if statusCode != 0 {
+		p.statuses[url] = statusCode
+	}
+}
+
+// startEdges writes the header of the edge list unless it was already. p.mu must be held.
+func (p *edgeListPublisher) startEdges() error {
+	if p.edgesStarted {
+		return nil
+	}
+	p.edgesStarted = true
+	return p.edges.Write(edgeHeader)
+}
+
+// startNodes writes the header of the node list unless it was already. p.mu must be held.
+func (p *edgeListPublisher) startNodes() error {
+	if p.nodesStarted {
+		return nil
+	}
+	p.nodesStarted = true
+	return p.nodes.Write(nodeHeader)
+}
+
+// writeNode writes the url to the node list. p.mu must be held.
+func (p *edgeListPublisher) writeNode(url string, meta Meta, outgoingLinks int) error {
+	if p.nodes == nil {
+		return nil
+	}
+	if err := p.startNodes(); err != nil {
+		return err
+	}
+	status := ""
+	if meta.StatusCode != 0 {
+		status = strconv.Itoa(meta.StatusCode)
+	}
+	return p.nodes.Write([]string{url, status, meta.ContentType, strconv.Itoa(meta.Depth), meta.Parent, strconv.Itoa(outgoingLinks)})
+}
+
+// flush writes what's buffered to both lists. p.mu must be held.
+func (p *edgeListPublisher) flush() error {
+	p.edges.Flush()
+	if err := p.edges.Error(); err != nil {
+		return err
+	}
+	if p.nodes == nil {
+		return nil
+	}
+	p.nodes.Flush()
+	return p.nodes.Error()
+}
+
+var _ Publisher = (*edgeListPublisher)(nil)
+var _ Resumable = (*edgeListPublisher)(nil)
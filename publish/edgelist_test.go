@@ -0,0 +1,169 @@
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeListPublisher(t *testing.T) {
+	tests := []struct {
+		name          string
+		newPublisher  func(edges, nodes *bytes.Buffer) Publisher
+		expectedEdges string
+		expectedNodes string
+	}{
+		{
+			name: "csv",
+			newPublisher: func(edges, nodes *bytes.Buffer) Publisher {
+				return NewCSVEdgeListPublisher(edges, nodes)
+			},
+			expectedEdges: "source,target,anchor_text,rel,is_internal,target_status\n" +
+				"https://example.com/,https://example.com/a,\"A, the first\",,true,\n" +
+				"https://example.com/,https://example.com/old,Old,,true,\n" +
+				"https://example.com/,https://example.com/gone,Gone,nofollow,true,\n" +
+				"https://example.com/,https://other.com/,Other,nofollow noopener,false,\n" +
+				"https://example.com/a,https://example.com/,Home,,true,200\n" +
+				"https://example.com/a,https://example.com/old,Old,,true,301\n" +
+				"https://example.com/a,https://example.com/gone,Gone,,true,404\n",
+			expectedNodes: "url,status,content_type,depth,parent,outgoing_links\n" +
+				"https://example.com/,200,text/html,0,,4\n" +
+				"https://example.com/gone,404,,1,https://example.com/,0\n" +
+				"https://example.com/old,301,,0,,0\n" +
+				"https://example.com/a,200,text/html,1,https://example.com/,3\n",
+		},
+		{
+			name: "tsv",
+			newPublisher: func(edges, nodes *bytes.Buffer) Publisher {
+				return NewTSVEdgeListPublisher(edges, nodes)
+			},
+			expectedEdges: "source\ttarget\tanchor_text\trel\tis_internal\ttarget_status\n" +
+				"https://example.com/\thttps://example.com/a\tA, the first\t\ttrue\t\n" +
+				"https://example.com/\thttps://example.com/old\tOld\t\ttrue\t\n" +
+				"https://example.com/\thttps://example.com/gone\tGone\tnofollow\ttrue\t\n" +
+				"https://example.com/\thttps://other.com/\tOther\tnofollow noopener\tfalse\t\n" +
+				"https://example.com/a\thttps://example.com/\tHome\t\ttrue\t200\n" +
+				"https://example.com/a\thttps://example.com/old\tOld\t\ttrue\t301\n" +
+				"https://example.com/a\thttps://example.com/gone\tGone\t\ttrue\t404\n",
+			expectedNodes: "url\tstatus\tcontent_type\tdepth\tparent\toutgoing_links\n" +
+				"https://example.com/\t200\ttext/html\t0\t\t4\n" +
+				"https://example.com/gone\t404\t\t1\thttps://example.com/\t0\n" +
+				"https://example.com/old\t301\t\t0\t\t0\n" +
+				"https://example.com/a\t200\ttext/html\t1\thttps://example.com/\t3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var edges, nodes bytes.Buffer
+			publisher := test.newPublisher(&edges, &nodes)
+
+			home := []Link{
+				{URL: "https://example.com/a", AnchorText: "A, the first", Internal: true},
+				{URL: "https://example.com/old", AnchorText: "Old", Internal: true},
+				{URL: "https://example.com/gone", AnchorText: "Gone", Rel: "nofollow", Internal: true},
+				{URL: "https://other.com/", AnchorText: "Other", Rel: "nofollow noopener"},
+			}
+			assert.NoError(t, publisher.Publish("https://example.com/", linkUrls(home), Meta{StatusCode: 200, ContentType: "text/html", Links: home}))
+			assert.NoError(t, publisher.RecordError("https://example.com/gone", ErrTypeNotFound, errors.New("failed with status 404"),
+				Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 404}))
+			assert.NoError(t, publisher.PublishRedirects([]Redirect{
+				{URL: "https://example.com/old", StatusCode: 301},
+				{URL: "https://example.com/a", StatusCode: 200},
+			}))
+			// the statuses of what was published so far are known by now
+			a := []Link{
+				{URL: "https://example.com/", AnchorText: "Home", Internal: true},
+				{URL: "https://example.com/old", AnchorText: "Old", Internal: true},
+				{URL: "https://example.com/gone", AnchorText: "Gone", Internal: true},
+			}
+			assert.NoError(t, publisher.Publish("https://example.com/a", linkUrls(a),
+				Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 200, ContentType: "text/html", Links: a}))
+			assert.NoError(t, publisher.PublishStats(Summary{}))
+
+			assert.Equal(t, test.expectedEdges, edges.String())
+			assert.Equal(t, test.expectedNodes, nodes.String())
+		})
+	}
+}
+
+func TestEdgeListPublisher_WithoutNodes(t *testing.T) {
+	var edges bytes.Buffer
+	publisher := NewCSVEdgeListPublisher(&edges, nil)
+
+	assert.NoError(t, publisher.Publish("https://example.com/", nil, Meta{StatusCode: 200}))
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+	assert.Equal(t, "source,target,anchor_text,rel,is_internal,target_status\n", edges.String())
+}
+
+func TestEdgeListPublisher_Streams(t *testing.T) {
+	var edges, nodes bytes.Buffer
+	publisher := NewCSVEdgeListPublisher(&edges, &nodes)
+
+	links := []Link{{URL: "https://example.com/a", Internal: true}}
+	assert.NoError(t, publisher.Publish("https://example.com/", linkUrls(links), Meta{StatusCode: 200, Links: links}))
+	// written along the way rather than once the crawl is over
+	assert.Equal(t, "source,target,anchor_text,rel,is_internal,target_status\nhttps://example.com/,https://example.com/a,,,true,\n", edges.String())
+	assert.Equal(t, "url,status,content_type,depth,parent,outgoing_links\nhttps://example.com/,200,,0,,1\n", nodes.String())
+
+	progress, err := publisher.(Resumable).Progress()
+	assert.NoError(t, err)
+	var resumedEdges, resumedNodes bytes.Buffer
+	resumed := NewCSVEdgeListPublisher(&resumedEdges, &resumedNodes)
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.Publish("https://example.com/a", nil, Meta{StatusCode: 200, Depth: 1}))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+	// appended to the files of the crawl which was resumed, without their headers
+	assert.Empty(t, resumedEdges.String())
+	assert.Equal(t, "https://example.com/a,200,,1,,0\n", resumedNodes.String())
+}
+
+func TestEdgeListPublisher_ResumedTruncatesFiles(t *testing.T) {
+	dir := t.TempDir()
+	edgesPath, nodesPath := filepath.Join(dir, "edges.csv"), filepath.Join(dir, "nodes.csv")
+	edges, nodes := appendTo(t, edgesPath), appendTo(t, nodesPath)
+	stopped := NewCSVEdgeListPublisher(edges, nodes)
+	links := []Link{{URL: "https://example.com/a", Internal: true}}
+	assert.NoError(t, stopped.Publish("https://example.com/", linkUrls(links), Meta{StatusCode: 200, Links: links}))
+	progress, err := stopped.(Resumable).Progress()
+	assert.NoError(t, err)
+	// published after the checkpoint was saved, so it's published again once resumed
+	assert.NoError(t, stopped.Publish("https://example.com/a", linkUrls(links), Meta{StatusCode: 200, Depth: 1, Links: links}))
+	assert.NoError(t, edges.Close())
+	assert.NoError(t, nodes.Close())
+
+	edges, nodes = appendTo(t, edgesPath), appendTo(t, nodesPath)
+	defer edges.Close()
+	defer nodes.Close()
+	resumed := NewCSVEdgeListPublisher(edges, nodes)
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.Publish("https://example.com/a", nil, Meta{StatusCode: 200, Depth: 1}))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+
+	written, err := os.ReadFile(edgesPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "source,target,anchor_text,rel,is_internal,target_status\nhttps://example.com/,https://example.com/a,,,true,\n", string(written))
+	written, err = os.ReadFile(nodesPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "url,status,content_type,depth,parent,outgoing_links\nhttps://example.com/,200,,0,,1\nhttps://example.com/a,200,,1,,0\n", string(written))
+}
+
+// appendTo opens the file the way the streamed outputs of a resumed crawl are.
+func appendTo(t *testing.T, path string) *os.File {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	return file
+}
+
+func linkUrls(links []Link) []string {
+	urls := make([]string, 0, len(links))
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	return urls
+}
@@ -1,12 +1,34 @@
 package publish
 
+// ErrType is the class of failure a page is recorded with.
 type ErrType string
 
 const (
+	// ErrTypeNotFound is a 404 or 410 status
 	ErrTypeNotFound ErrType = "not_found"
+	// ErrTypeNoAccess is a 401 or 403 status
 	ErrTypeNoAccess ErrType = "no_access"
+	// ErrTypeRateLimited is a 429 status which was still there after the retries
+	ErrTypeRateLimited ErrType = "rate_limited"
+	// ErrTypeClient is any other 4xx status
+	ErrTypeClient ErrType = "client_error"
+	// ErrTypeInternal is a 5xx status
 	ErrTypeInternal ErrType = "internal_issue"
-	ErrTypeUnknown  ErrType = "unknown"
+	// ErrTypeStatus is any other status which can't be crawled e.g. 202 or a redirect without a Location
+	ErrTypeStatus ErrType = "unexpected_status"
+	// ErrTypeRedirect is a redirect loop or too many redirects
+	ErrTypeRedirect   ErrType = "redirect"
+	ErrTypeTimeout    ErrType = "timeout"
+	ErrTypeDNS        ErrType = "dns"
+	ErrTypeConnection ErrType = "connection"
+	ErrTypeTLS        ErrType = "tls"
+	// ErrTypeTooLarge is a page bigger than what's downloaded
+	ErrTypeTooLarge ErrType = "too_large"
+	// ErrTypeParse is a url or a page which couldn't be parsed
+	ErrTypeParse ErrType = "parse"
+	// ErrTypeMissingAnchor is a `#fragment` link to a page which has no element of that id or name
+	ErrTypeMissingAnchor ErrType = "missing_anchor"
+	ErrTypeUnknown       ErrType = "unknown"
 )
 
 type Error struct {
@@ -0,0 +1,347 @@
+package publish
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+type GraphFormat string
+
+const (
+	GraphFormatDOT     GraphFormat = "dot"
+	GraphFormatGraphML GraphFormat = "graphml"
+	GraphFormatGEXF    GraphFormat = "gexf"
+)
+
+// GraphOptions configures the graph written by a graph publisher.
+type GraphOptions struct {
+	Format GraphFormat
+	// ClusterDepth groups the pages by host and their first ClusterDepth path segments, 0 for no clustering
+	ClusterDepth int
+	// SpillDir keeps the edges in a temporary file within it instead of memory, the pages are always kept in memory
+	SpillDir string
+}
+
+// graphNode is a page of the graph, crawled or only linked to.
+type graphNode struct {
+	id     int
+	url    string
+	status int
+	// depth is -1 for pages which weren't reached by the crawl
+	depth   int
+	cluster string
+}
+
+// graphPublisher collects the pages and the links between them, writing the whole graph once the crawl is over.
+type graphPublisher struct {
+	mu      sync.Mutex
+	w       io.Writer
+	options GraphOptions
+	nodes   map[string]*graphNode
+	// ordered is the nodes in the order they were found, so the output is stable
+	ordered []*graphNode
+	edges   edgeStore
+	// restoredFile is the edges file of the crawl this one resumed, removed once the graph is written
+	restoredFile string
+}
+
+// NewGraphPublisher writes the link graph of the crawl to w in the format of the options once the crawl is over.
+func NewGraphPublisher(w io.Writer, options GraphOptions) (Publisher, error) {
+	switch options.Format {
+	case GraphFormatDOT, GraphFormatGraphML, GraphFormatGEXF:
+	default:
+		return nil, fmt.Errorf("unknown graph format %q", options.Format)
+	}
+	var edges edgeStore = &memoryEdgeStore{}
+	if options.SpillDir != "" {
+		fileEdges, err := newFileEdgeStore(options.SpillDir)
+		if err != nil {
+			return nil, err
+		}
+		edges = fileEdges
+	}
+	return &graphPublisher{
+		w:       w,
+		options: options,
+		nodes:   make(map[string]*graphNode),
+		ordered: make([]*graphNode, 0),
+		edges:   edges,
+	}, nil
+}
+
+func (g *graphPublisher) Publish(title string, lines []string, meta Meta) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	page := g.node(title)
+	page.status = meta.StatusCode
+	page.depth = meta.Depth
+	for _, line := range lines {
+		if err := g.edges.add(page.id, g.node(line).id); err != nil {
+			return fmt.Errorf("failed to store edge: %w", err)
+		}
+	}
+	return nil
+}
+
+func (g *graphPublisher) RecordError(url string, _ ErrType, _ error, meta Meta) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	page := g.node(url)
+	page.status = meta.StatusCode
+	page.depth = meta.Depth
+	return nil
+}
+
+// PublishRedirects records the status of the redirecting urls, their edges aren't part of the graph.
+func (g *graphPublisher) PublishRedirects(chain []Redirect) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, hop := range chain {
+		if node, exists := g.nodes[hop.URL]; exists {
+			node.status = hop.StatusCode
+		}
+	}
+	return nil
+}
+
+func (g *graphPublisher) PublishStats(_ Summary) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer g.edges.close()
+	out := bufio.NewWriter(g.w)
+	var err error
+	switch g.options.Format {
+	case GraphFormatDOT:
+		err = g.writeDOT(out)
+	case GraphFormatGraphML:
+		err = g.writeGraphML(out)
+	case GraphFormatGEXF:
+		err = g.writeGEXF(out)
+	}
+	if err != nil {
+		return err
+	}
+	if g.restoredFile != "" {
+		_ = os.Remove(g.restoredFile)
+	}
+	return out.Flush()
+}
+
+// graphProgress is the part of graphPublisher which is saved in checkpoints, so the graph of a resumed crawl
+// has the pages and links found before it was stopped. the edges are either saved along,
+// or left in the edges file when they're spilled to disk, only its length is saved then.
+type graphProgress struct {
+	// Nodes are in the order they were found, their index being their id
+	Nodes []graphNodeProgress `json:"nodes"`
+	Edges [][2]int            `json:"edges,omitempty"`
+	// EdgesFile has the edges up to EdgesOffset, the ones written after the checkpoint was saved are left out
+	EdgesFile   string `json:"edges_file,omitempty"`
+	EdgesOffset int64  `json:"edges_offset,omitempty"`
+}
+
+type graphNodeProgress struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Depth  int    `json:"depth"`
+}
+
+func (g *graphPublisher) Progress() ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	progress := graphProgress{Nodes: make([]graphNodeProgress, 0, len(g.ordered))}
+	for _, node := range g.ordered {
+		progress.Nodes = append(progress.Nodes, graphNodeProgress{URL: node.url, Status: node.status, Depth: node.depth})
+	}
+	if err := g.edges.save(&progress); err != nil {
+		return nil, fmt.Errorf("failed to save edges: %w", err)
+	}
+	return json.Marshal(progress)
+}
+
+func (g *graphPublisher) Restore(progress []byte) error {
+	restored := graphProgress{}
+	if err := json.Unmarshal(progress, &restored); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, saved := range restored.Nodes {
+		node := g.node(saved.URL)
+		node.status, node.depth = saved.Status, saved.Depth
+	}
+	for _, e := range restored.Edges {
+		if err := g.edges.add(e[0], e[1]); err != nil {
+			return fmt.Errorf("failed to restore edges: %w", err)
+		}
+	}
+	if restored.EdgesFile == "" {
+		return nil
+	}
+	file, err := os.Open(restored.EdgesFile)
+	if err != nil {
+		return fmt.Errorf("failed to restore edges: %w", err)
+	}
+	defer file.Close()
+	err = readEdges(io.LimitReader(file, restored.EdgesOffset), g.edges.add)
+	if err != nil {
+		return fmt.Errorf("failed to restore edges from %s: %w", restored.EdgesFile, err)
+	}
+	g.restoredFile = restored.EdgesFile
+	return nil
+}
+
+// node returns the node of the url, adding it if it's new. g.mu must be held.
+func (g *graphPublisher) node(url string) *graphNode {
+	if node, exists := g.nodes[url]; exists {
+		return node
+	}
+	node := &graphNode{id: len(g.ordered), url: url, depth: -1}
+	if g.options.ClusterDepth > 0 {
+		node.cluster = clusterOf(url, g.options.ClusterDepth)
+	}
+	g.nodes[url] = node
+	g.ordered = append(g.ordered, node)
+	return node
+}
+
+// clusterOf returns the host of the url along with its first depth path segments e.g. "example.com/docs/api"
+func clusterOf(rawUrl string, depth int) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	segments := make([]string, 0, depth)
+	for _, segment := range strings.Split(u.Path, "/") {
+		if len(segments) == depth {
+			break
+		}
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return u.Host + "/" + strings.Join(segments, "/")
+}
+
+// edgeStore keeps the edges of the graph until it's written.
+type edgeStore interface {
+	add(from, to int) error
+	// each calls fn for every edge, in the order they were added
+	each(fn func(from, to int) error) error
+	// save records the edges added so far in the progress of the publisher
+	save(progress *graphProgress) error
+	close() error
+}
+
+type memoryEdgeStore struct {
+	edges [][2]int
+}
+
+func (m *memoryEdgeStore) add(from, to int) error {
+	m.edges = append(m.edges, [2]int{from, to})
+	return nil
+}
+
+func (m *memoryEdgeStore) each(fn func(from, to int) error) error {
+	for _, e := range m.edges {
+		if err := fn(e[0], e[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryEdgeStore) save(progress *graphProgress) error {
+	progress.Edges = append([][2]int(nil), m.edges...)
+	return nil
+}
+
+func (m *memoryEdgeStore) close() error {
+	m.edges = nil
+	return nil
+}
+
+// fileEdgeStore appends the edges to a temporary file as pairs of varints.
+type fileEdgeStore struct {
+	file   *os.File
+	writer *bufio.Writer
+	buf    [2 * binary.MaxVarintLen64]byte
+}
+
+func newFileEdgeStore(dir string) (*fileEdgeStore, error) {
+	file, err := os.CreateTemp(dir, "edges-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create edges file: %w", err)
+	}
+	return &fileEdgeStore{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (f *fileEdgeStore) add(from, to int) error {
+	n := binary.PutUvarint(f.buf[:], uint64(from))
+	n += binary.PutUvarint(f.buf[n:], uint64(to))
+	_, err := f.writer.Write(f.buf[:n])
+	return err
+}
+
+func (f *fileEdgeStore) each(fn func(from, to int) error) error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := readEdges(f.file, fn); err != nil {
+		return err
+	}
+	// edges added afterward go at the end
+	_, err := f.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// save flushes the edges so the file has them all, up to its current length.
+func (f *fileEdgeStore) save(progress *graphProgress) error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	offset, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	progress.EdgesFile, progress.EdgesOffset = f.file.Name(), offset
+	return nil
+}
+
+func (f *fileEdgeStore) close() error {
+	_ = f.file.Close()
+	return os.Remove(f.file.Name())
+}
+
+// readEdges calls fn for every edge of r, written as pairs of varints by a fileEdgeStore.
+func readEdges(r io.Reader, fn func(from, to int) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		from, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		to, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return err
+		}
+		if err := fn(int(from), int(to)); err != nil {
+			return err
+		}
+	}
+}
+
+var _ Publisher = (*graphPublisher)(nil)
+var _ Resumable = (*graphPublisher)(nil)
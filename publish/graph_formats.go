@@ -0,0 +1,165 @@
+package publish
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// writers of the graph formats, errors writing to out are kept by it and returned when flushing.
+
+// writeDOT writes the graph for Graphviz, clusters are subgraphs which get drawn as boxes around their pages.
+func (g *graphPublisher) writeDOT(out *bufio.Writer) error {
+	_, _ = out.WriteString("digraph spider {\n")
+	if g.options.ClusterDepth > 0 {
+		for i, cluster := range g.clusters() {
+			_, _ = fmt.Fprintf(out, "  subgraph cluster_%d {\n    label=%s;\n", i, dotQuote(cluster.name))
+			for _, node := range cluster.nodes {
+				g.writeDOTNode(out, "    ", node)
+			}
+			_, _ = out.WriteString("  }\n")
+		}
+	} else {
+		for _, node := range g.ordered {
+			g.writeDOTNode(out, "  ", node)
+		}
+	}
+	err := g.edges.each(func(from, to int) error {
+		_, _ = fmt.Fprintf(out, "  n%d -> n%d;\n", from, to)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read edges: %w", err)
+	}
+	_, _ = out.WriteString("}\n")
+	return nil
+}
+
+func (g *graphPublisher) writeDOTNode(out *bufio.Writer, indent string, node *graphNode) {
+	attributes := []string{"label=" + dotQuote(node.url)}
+	if node.status != 0 {
+		attributes = append(attributes, "status="+strconv.Itoa(node.status))
+	}
+	if node.depth >= 0 {
+		attributes = append(attributes, "depth="+strconv.Itoa(node.depth))
+	}
+	_, _ = fmt.Fprintf(out, "%sn%d [%s];\n", indent, node.id, strings.Join(attributes, ", "))
+}
+
+// writeGraphML writes the graph as GraphML, the cluster of a page is one of its attributes.
+func (g *graphPublisher) writeGraphML(out *bufio.Writer) error {
+	_, _ = out.WriteString(xml.Header)
+	_, _ = out.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	_, _ = out.WriteString(`  <key id="url" for="node" attr.name="url" attr.type="string"/>` + "\n")
+	_, _ = out.WriteString(`  <key id="status" for="node" attr.name="status" attr.type="int"/>` + "\n")
+	_, _ = out.WriteString(`  <key id="depth" for="node" attr.name="depth" attr.type="int"/>` + "\n")
+	if g.options.ClusterDepth > 0 {
+		_, _ = out.WriteString(`  <key id="cluster" for="node" attr.name="cluster" attr.type="string"/>` + "\n")
+	}
+	_, _ = out.WriteString(`  <graph id="spider" edgedefault="directed">` + "\n")
+	for _, node := range g.ordered {
+		_, _ = fmt.Fprintf(out, `    <node id="n%d"><data key="url">%s</data>`, node.id, xmlEscape(node.url))
+		if node.status != 0 {
+			_, _ = fmt.Fprintf(out, `<data key="status">%d</data>`, node.status)
+		}
+		if node.depth >= 0 {
+			_, _ = fmt.Fprintf(out, `<data key="depth">%d</data>`, node.depth)
+		}
+		if g.options.ClusterDepth > 0 {
+			_, _ = fmt.Fprintf(out, `<data key="cluster">%s</data>`, xmlEscape(node.cluster))
+		}
+		_, _ = out.WriteString("</node>\n")
+	}
+	edge := 0
+	err := g.edges.each(func(from, to int) error {
+		_, _ = fmt.Fprintf(out, `    <edge id="e%d" source="n%d" target="n%d"/>`+"\n", edge, from, to)
+		edge++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read edges: %w", err)
+	}
+	_, _ = out.WriteString("  </graph>\n</graphml>\n")
+	return nil
+}
+
+// attribute ids of the pages in GEXF
+const (
+	gexfStatus  = "0"
+	gexfDepth   = "1"
+	gexfCluster = "2"
+)
+
+// writeGEXF writes the graph as GEXF for Gephi, the cluster of a page is one of its attributes so it can be partitioned by it.
+func (g *graphPublisher) writeGEXF(out *bufio.Writer) error {
+	_, _ = out.WriteString(xml.Header)
+	_, _ = out.WriteString(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	_, _ = out.WriteString(`  <graph defaultedgetype="directed">` + "\n")
+	_, _ = out.WriteString(`    <attributes class="node">` + "\n")
+	_, _ = out.WriteString(`      <attribute id="` + gexfStatus + `" title="status" type="integer"/>` + "\n")
+	_, _ = out.WriteString(`      <attribute id="` + gexfDepth + `" title="depth" type="integer"/>` + "\n")
+	if g.options.ClusterDepth > 0 {
+		_, _ = out.WriteString(`      <attribute id="` + gexfCluster + `" title="cluster" type="string"/>` + "\n")
+	}
+	_, _ = out.WriteString("    </attributes>\n    <nodes>\n")
+	for _, node := range g.ordered {
+		_, _ = fmt.Fprintf(out, `      <node id="n%d" label="%s"><attvalues>`, node.id, xmlEscape(node.url))
+		if node.status != 0 {
+			_, _ = fmt.Fprintf(out, `<attvalue for="%s" value="%d"/>`, gexfStatus, node.status)
+		}
+		if node.depth >= 0 {
+			_, _ = fmt.Fprintf(out, `<attvalue for="%s" value="%d"/>`, gexfDepth, node.depth)
+		}
+		if g.options.ClusterDepth > 0 {
+			_, _ = fmt.Fprintf(out, `<attvalue for="%s" value="%s"/>`, gexfCluster, xmlEscape(node.cluster))
+		}
+		_, _ = out.WriteString("</attvalues></node>\n")
+	}
+	_, _ = out.WriteString("    </nodes>\n    <edges>\n")
+	edge := 0
+	err := g.edges.each(func(from, to int) error {
+		_, _ = fmt.Fprintf(out, `      <edge id="e%d" source="n%d" target="n%d"/>`+"\n", edge, from, to)
+		edge++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read edges: %w", err)
+	}
+	_, _ = out.WriteString("    </edges>\n  </graph>\n</gexf>\n")
+	return nil
+}
+
+type graphCluster struct {
+	name  string
+	nodes []*graphNode
+}
+
+// clusters groups the nodes by their cluster, in the order the clusters were found. g.mu must be held.
+func (g *graphPublisher) clusters() []*graphCluster {
+	byName := make(map[string]*graphCluster)
+	clusters := make([]*graphCluster, 0)
+	for _, node := range g.ordered {
+		cluster, exists := byName[node.cluster]
+		if !exists {
+			cluster = &graphCluster{name: node.cluster}
+			byName[node.cluster] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.nodes = append(cluster.nodes, node)
+	}
+	return clusters
+}
+
+// dotQuote quotes s as a DOT string.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// xmlEscape escapes s for both XML text and attribute values.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
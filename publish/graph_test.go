@@ -0,0 +1,193 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// publishGraph publishes a site of a home page linking to a docs page, a missing page and another site.
+func publishGraph(t *testing.T, publisher Publisher) {
+	t.Helper()
+	home := []string{"https://example.com/docs/api/intro", "https://example.com/gone", "https://other.com/?a=1&b=\"2\""}
+	assert.NoError(t, publisher.Publish("https://example.com/", home, Meta{StatusCode: 200}))
+	assert.NoError(t, publisher.RecordError("https://example.com/gone", ErrTypeNotFound, errors.New("failed with status 404"),
+		Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 404}))
+	assert.NoError(t, publisher.Publish("https://example.com/docs/api/intro", []string{"https://example.com/"},
+		Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 200}))
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+}
+
+func TestGraphPublisher_DOT(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  GraphOptions
+		expected string
+	}{
+		{
+			name:    "without clusters",
+			options: GraphOptions{Format: GraphFormatDOT},
+			expected: "digraph spider {\n" +
+				"  n0 [label=\"https://example.com/\", status=200, depth=0];\n" +
+				"  n1 [label=\"https://example.com/docs/api/intro\", status=200, depth=1];\n" +
+				"  n2 [label=\"https://example.com/gone\", status=404, depth=1];\n" +
+				"  n3 [label=\"https://other.com/?a=1&b=\\\"2\\\"\"];\n" +
+				"  n0 -> n1;\n  n0 -> n2;\n  n0 -> n3;\n  n1 -> n0;\n" +
+				"}\n",
+		},
+		{
+			name:    "clustered by the first path segment",
+			options: GraphOptions{Format: GraphFormatDOT, ClusterDepth: 1},
+			expected: "digraph spider {\n" +
+				"  subgraph cluster_0 {\n    label=\"example.com/\";\n" +
+				"    n0 [label=\"https://example.com/\", status=200, depth=0];\n" +
+				"  }\n" +
+				"  subgraph cluster_1 {\n    label=\"example.com/docs\";\n" +
+				"    n1 [label=\"https://example.com/docs/api/intro\", status=200, depth=1];\n" +
+				"  }\n" +
+				"  subgraph cluster_2 {\n    label=\"example.com/gone\";\n" +
+				"    n2 [label=\"https://example.com/gone\", status=404, depth=1];\n" +
+				"  }\n" +
+				"  subgraph cluster_3 {\n    label=\"other.com/\";\n" +
+				"    n3 [label=\"https://other.com/?a=1&b=\\\"2\\\"\"];\n" +
+				"  }\n" +
+				"  n0 -> n1;\n  n0 -> n2;\n  n0 -> n3;\n  n1 -> n0;\n" +
+				"}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			publisher, err := NewGraphPublisher(&out, test.options)
+			assert.NoError(t, err)
+
+			publishGraph(t, publisher)
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestGraphPublisher_XML(t *testing.T) {
+	tests := []struct {
+		format   GraphFormat
+		spill    bool
+		expected string
+	}{
+		{
+			format: GraphFormatGraphML,
+			expected: xml.Header +
+				`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n" +
+				`  <key id="url" for="node" attr.name="url" attr.type="string"/>` + "\n" +
+				`  <key id="status" for="node" attr.name="status" attr.type="int"/>` + "\n" +
+				`  <key id="depth" for="node" attr.name="depth" attr.type="int"/>` + "\n" +
+				`  <key id="cluster" for="node" attr.name="cluster" attr.type="string"/>` + "\n" +
+				`  <graph id="spider" edgedefault="directed">` + "\n" +
+				`    <node id="n0"><data key="url">https://example.com/</data><data key="status">200</data><data key="depth">0</data><data key="cluster">example.com/</data></node>` + "\n" +
+				`    <node id="n1"><data key="url">https://example.com/docs/api/intro</data><data key="status">200</data><data key="depth">1</data><data key="cluster">example.com/docs/api</data></node>` + "\n" +
+				`    <node id="n2"><data key="url">https://example.com/gone</data><data key="status">404</data><data key="depth">1</data><data key="cluster">example.com/gone</data></node>` + "\n" +
+				`    <node id="n3"><data key="url">https://other.com/?a=1&amp;b=&#34;2&#34;</data><data key="cluster">other.com/</data></node>` + "\n" +
+				`    <edge id="e0" source="n0" target="n1"/>` + "\n" +
+				`    <edge id="e1" source="n0" target="n2"/>` + "\n" +
+				`    <edge id="e2" source="n0" target="n3"/>` + "\n" +
+				`    <edge id="e3" source="n1" target="n0"/>` + "\n" +
+				"  </graph>\n</graphml>\n",
+		},
+		{
+			format: GraphFormatGEXF,
+			spill:  true,
+			expected: xml.Header +
+				`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n" +
+				`  <graph defaultedgetype="directed">` + "\n" +
+				`    <attributes class="node">` + "\n" +
+				`      <attribute id="0" title="status" type="integer"/>` + "\n" +
+				`      <attribute id="1" title="depth" type="integer"/>` + "\n" +
+				`      <attribute id="2" title="cluster" type="string"/>` + "\n" +
+				"    </attributes>\n    <nodes>\n" +
+				`      <node id="n0" label="https://example.com/"><attvalues><attvalue for="0" value="200"/><attvalue for="1" value="0"/><attvalue for="2" value="example.com/"/></attvalues></node>` + "\n" +
+				`      <node id="n1" label="https://example.com/docs/api/intro"><attvalues><attvalue for="0" value="200"/><attvalue for="1" value="1"/><attvalue for="2" value="example.com/docs/api"/></attvalues></node>` + "\n" +
+				`      <node id="n2" label="https://example.com/gone"><attvalues><attvalue for="0" value="404"/><attvalue for="1" value="1"/><attvalue for="2" value="example.com/gone"/></attvalues></node>` + "\n" +
+				`      <node id="n3" label="https://other.com/?a=1&amp;b=&#34;2&#34;"><attvalues><attvalue for="2" value="other.com/"/></attvalues></node>` + "\n" +
+				"    </nodes>\n    <edges>\n" +
+				`      <edge id="e0" source="n0" target="n1"/>` + "\n" +
+				`      <edge id="e1" source="n0" target="n2"/>` + "\n" +
+				`      <edge id="e2" source="n0" target="n3"/>` + "\n" +
+				`      <edge id="e3" source="n1" target="n0"/>` + "\n" +
+				"    </edges>\n  </graph>\n</gexf>\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			options := GraphOptions{Format: test.format, ClusterDepth: 2}
+			if test.spill {
+				options.SpillDir = t.TempDir()
+			}
+			var out bytes.Buffer
+			publisher, err := NewGraphPublisher(&out, options)
+			assert.NoError(t, err)
+
+			publishGraph(t, publisher)
+			assert.Equal(t, test.expected, out.String())
+			assert.NoError(t, xml.Unmarshal(out.Bytes(), new(struct{})), "not well-formed")
+			if test.spill {
+				spilled, err := os.ReadDir(options.SpillDir)
+				assert.NoError(t, err)
+				assert.Empty(t, spilled, "edges file left behind")
+			}
+		})
+	}
+}
+
+func TestGraphPublisher_Resumed(t *testing.T) {
+	for _, spill := range []bool{false, true} {
+		t.Run(fmt.Sprintf("spill %t", spill), func(t *testing.T) {
+			options := GraphOptions{Format: GraphFormatDOT}
+			if spill {
+				options.SpillDir = t.TempDir()
+			}
+			stopped, err := NewGraphPublisher(&bytes.Buffer{}, options)
+			assert.NoError(t, err)
+			home := []string{"https://example.com/docs/api/intro", "https://example.com/gone", "https://other.com/?a=1&b=\"2\""}
+			assert.NoError(t, stopped.Publish("https://example.com/", home, Meta{StatusCode: 200}))
+			progress, err := stopped.(Resumable).Progress()
+			assert.NoError(t, err)
+			// published after the checkpoint was saved, so it's published again once resumed
+			assert.NoError(t, stopped.Publish("https://example.com/docs/api/intro", []string{"https://example.com/"},
+				Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 200}))
+
+			var out bytes.Buffer
+			resumed, err := NewGraphPublisher(&out, options)
+			assert.NoError(t, err)
+			assert.NoError(t, resumed.(Resumable).Restore(progress))
+			assert.NoError(t, resumed.RecordError("https://example.com/gone", ErrTypeNotFound, errors.New("failed with status 404"),
+				Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 404}))
+			assert.NoError(t, resumed.Publish("https://example.com/docs/api/intro", []string{"https://example.com/"},
+				Meta{Depth: 1, Parent: "https://example.com/", StatusCode: 200}))
+			assert.NoError(t, resumed.PublishStats(Summary{}))
+
+			assert.Equal(t, "digraph spider {\n"+
+				"  n0 [label=\"https://example.com/\", status=200, depth=0];\n"+
+				"  n1 [label=\"https://example.com/docs/api/intro\", status=200, depth=1];\n"+
+				"  n2 [label=\"https://example.com/gone\", status=404, depth=1];\n"+
+				"  n3 [label=\"https://other.com/?a=1&b=\\\"2\\\"\"];\n"+
+				"  n0 -> n1;\n  n0 -> n2;\n  n0 -> n3;\n  n1 -> n0;\n"+
+				"}\n", out.String())
+			if spill {
+				spilled, err := os.ReadDir(options.SpillDir)
+				assert.NoError(t, err)
+				assert.Empty(t, spilled, "edges file left behind")
+			}
+		})
+	}
+}
+
+func TestNewGraphPublisher_UnknownFormat(t *testing.T) {
+	_, err := NewGraphPublisher(&bytes.Buffer{}, GraphOptions{Format: "svg"})
+	assert.ErrorContains(t, err, `unknown graph format "svg"`)
+}
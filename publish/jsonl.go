@@ -0,0 +1,209 @@
+package publish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// record types of the JSON Lines output, found in the "type" field of every record
+const (
+	RecordTypePage     = "page"
+	RecordTypeError    = "error"
+	RecordTypeRedirect = "redirect"
+	RecordTypeStats    = "stats"
+)
+
+type pageRecord struct {
+	Type            string   `json:"type"`
+	URL             string   `json:"url"`
+	Seed            string   `json:"seed,omitempty"`
+	Status          int      `json:"status"`
+	ContentType     string   `json:"content_type"`
+	Depth           int      `json:"depth"`
+	Parent          string   `json:"parent,omitempty"`
+	AnchorText      string   `json:"anchor_text,omitempty"`
+	Links           []string `json:"links"`
+	FetchDurationMs int64    `json:"fetch_duration_ms"`
+}
+
+type errorRecord struct {
+	Type            string  `json:"type"`
+	URL             string  `json:"url"`
+	Seed            string  `json:"seed,omitempty"`
+	ErrorType       ErrType `json:"error_type"`
+	Error           string  `json:"error"`
+	Status          int     `json:"status,omitempty"`
+	Depth           int     `json:"depth"`
+	Parent          string  `json:"parent,omitempty"`
+	AnchorText      string  `json:"anchor_text,omitempty"`
+	FetchDurationMs int64   `json:"fetch_duration_ms"`
+}
+
+type redirectRecord struct {
+	Type  string     `json:"type"`
+	Chain []Redirect `json:"chain"`
+}
+
+type statsRecord struct {
+	Type        string            `json:"type"`
+	Pages       int               `json:"pages"`
+	Links       int               `json:"links"`
+	Errors      int               `json:"errors"`
+	ErrorTypes  map[ErrType]int   `json:"errors_by_type,omitempty"`
+	Seeds       seedCounts        `json:"seeds,omitempty"`
+	Redirects   int               `json:"redirects"`
+	DurationMs  int64             `json:"duration_ms"`
+	StopReason  string            `json:"stop_reason,omitempty"`
+	CappedHosts []string          `json:"capped_hosts,omitempty"`
+	VisitedSets []VisitedSetStats `json:"visited_sets,omitempty"`
+	Async       *AsyncStats       `json:"async,omitempty"`
+}
+
+// jsonlPublisher writes a JSON object per line for every page, error and redirect chain, followed by a stats record.
+type jsonlPublisher struct {
+	mu        sync.Mutex
+	out       *streamOutput
+	encoder   *json.Encoder
+	createdAt time.Time
+	pages     int
+	links     int
+	errors    int
+	// errorTypes is the amount of errors of every type
+	errorTypes map[ErrType]int
+	seeds      seedCounts
+	redirects  int
+}
+
+// NewJSONLPublisher writes the crawl to w as JSON Lines, one record per line with its kind in the "type" field.
+func NewJSONLPublisher(w io.Writer) Publisher {
+	out := newStreamOutput(w)
+	return &jsonlPublisher{
+		out:        out,
+		encoder:    json.NewEncoder(out),
+		createdAt:  time.Now(),
+		errorTypes: make(map[ErrType]int),
+		seeds:      make(seedCounts),
+	}
+}
+
+func (j *jsonlPublisher) Publish(title string, lines []string, meta Meta) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pages++
+	j.links += len(lines)
+	j.seeds.count(meta.Seed, 1, 0)
+	if lines == nil {
+		lines = []string{}
+	}
+	return j.encoder.Encode(pageRecord{
+		Type:            RecordTypePage,
+		URL:             title,
+		Seed:            meta.Seed,
+		Status:          meta.StatusCode,
+		ContentType:     meta.ContentType,
+		Depth:           meta.Depth,
+		Parent:          meta.Parent,
+		AnchorText:      meta.AnchorText,
+		Links:           lines,
+		FetchDurationMs: meta.Duration.Milliseconds(),
+	})
+}
+
+func (j *jsonlPublisher) RecordError(url string, failedFor ErrType, err error, meta Meta) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.errors++
+	j.errorTypes[failedFor]++
+	j.seeds.count(meta.Seed, 0, 1)
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	return j.encoder.Encode(errorRecord{
+		Type:            RecordTypeError,
+		URL:             url,
+		Seed:            meta.Seed,
+		ErrorType:       failedFor,
+		Error:           message,
+		Status:          meta.StatusCode,
+		Depth:           meta.Depth,
+		Parent:          meta.Parent,
+		AnchorText:      meta.AnchorText,
+		FetchDurationMs: meta.Duration.Milliseconds(),
+	})
+}
+
+func (j *jsonlPublisher) PublishRedirects(chain []Redirect) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.redirects++
+	return j.encoder.Encode(redirectRecord{Type: RecordTypeRedirect, Chain: chain})
+}
+
+func (j *jsonlPublisher) PublishStats(summary Summary) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.encoder.Encode(statsRecord{
+		Type:        RecordTypeStats,
+		Pages:       j.pages,
+		Links:       j.links,
+		Errors:      j.errors,
+		ErrorTypes:  j.errorTypes,
+		Seeds:       j.seeds,
+		Redirects:   j.redirects,
+		DurationMs:  time.Since(j.createdAt).Milliseconds(),
+		StopReason:  summary.StopReason,
+		CappedHosts: summary.CappedHosts,
+		VisitedSets: summary.VisitedSets,
+		Async:       summary.Async,
+	})
+}
+
+// jsonlProgress is the part of jsonlPublisher which is saved in checkpoints.
+type jsonlProgress struct {
+	Pages      int             `json:"pages"`
+	Links      int             `json:"links"`
+	Errors     int             `json:"errors"`
+	ErrorTypes map[ErrType]int `json:"errors_by_type,omitempty"`
+	Seeds      seedCounts      `json:"seeds,omitempty"`
+	Redirects  int             `json:"redirects"`
+	// Length is the length of the output, cut back to it when resuming
+	Length *int64 `json:"length,omitempty"`
+}
+
+func (j *jsonlPublisher) Progress() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return json.Marshal(jsonlProgress{Pages: j.pages, Links: j.links, Errors: j.errors, ErrorTypes: j.errorTypes, Seeds: j.seeds, Redirects: j.redirects, Length: &j.out.length})
+}
+
+func (j *jsonlPublisher) Restore(progress []byte) error {
+	restored := jsonlProgress{}
+	if err := json.Unmarshal(progress, &restored); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.out.truncate(restored.Length); err != nil {
+		return fmt.Errorf("failed to truncate the output: %w", err)
+	}
+	j.pages, j.links, j.errors, j.redirects = restored.Pages, restored.Links, restored.Errors, restored.Redirects
+	j.errorTypes = restored.ErrorTypes
+	if j.errorTypes == nil {
+		j.errorTypes = make(map[ErrType]int)
+	}
+	j.seeds = restored.Seeds
+	if j.seeds == nil {
+		j.seeds = make(seedCounts)
+	}
+	return nil
+}
+
+var _ Publisher = (*jsonlPublisher)(nil)
+var _ Resumable = (*jsonlPublisher)(nil)
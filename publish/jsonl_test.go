@@ -0,0 +1,133 @@
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLPublisher(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewJSONLPublisher(&out)
+
+	assert.NoError(t, publisher.Publish("https://example.com/", []string{"https://example.com/a"}, Meta{
+		StatusCode:  200,
+		ContentType: "text/html",
+		Duration:    1500 * time.Millisecond,
+	}))
+	assert.NoError(t, publisher.PublishRedirects([]Redirect{
+		{URL: "https://example.com/old", StatusCode: 301},
+		{URL: "https://example.com/a", StatusCode: 200},
+	}))
+	assert.NoError(t, publisher.RecordError("https://example.com/b", ErrTypeNotFound, errors.New("failed with status 404"), Meta{
+		Depth:      1,
+		Parent:     "https://example.com/",
+		AnchorText: "B",
+		StatusCode: 404,
+	}))
+	assert.NoError(t, publisher.PublishStats(Summary{StopReason: "max pages of 3"}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []map[string]any{
+		{
+			"type": "page", "url": "https://example.com/", "status": 200.0, "content_type": "text/html",
+			"depth": 0.0, "links": []any{"https://example.com/a"}, "fetch_duration_ms": 1500.0,
+		},
+		{
+			"type": "redirect", "chain": []any{
+				map[string]any{"url": "https://example.com/old", "status": 301.0},
+				map[string]any{"url": "https://example.com/a", "status": 200.0},
+			},
+		},
+		{
+			"type": "error", "url": "https://example.com/b", "error_type": "not_found", "error": "failed with status 404",
+			"status": 404.0, "depth": 1.0, "parent": "https://example.com/", "anchor_text": "B", "fetch_duration_ms": 0.0,
+		},
+	}
+	if assert.Len(t, lines, 4) {
+		for i, want := range expected {
+			record := map[string]any{}
+			assert.NoError(t, json.Unmarshal([]byte(lines[i]), &record))
+			assert.Equal(t, want, record)
+		}
+
+		stats := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[3]), &stats))
+		assert.Equal(t, "stats", stats["type"])
+		assert.Equal(t, 1.0, stats["pages"])
+		assert.Equal(t, 1.0, stats["links"])
+		assert.Equal(t, 1.0, stats["errors"])
+		assert.Equal(t, map[string]any{"not_found": 1.0}, stats["errors_by_type"])
+		assert.Equal(t, 1.0, stats["redirects"])
+		assert.Equal(t, "max pages of 3", stats["stop_reason"])
+	}
+}
+
+func TestJSONLPublisher_EmptyLinks(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewJSONLPublisher(&out)
+
+	assert.NoError(t, publisher.Publish("https://example.com/", nil, Meta{}))
+	assert.Contains(t, out.String(), `"links":[]`)
+}
+
+func TestJSONLPublisher_Seeds(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewJSONLPublisher(&out)
+	assert.NoError(t, publisher.Publish("https://example.com/", nil, Meta{Seed: "https://example.com/"}))
+	assert.NoError(t, publisher.Publish("https://docs.example.com/", nil, Meta{Seed: "https://docs.example.com/"}))
+	// the counts of the seeds are resumed along with the others
+	progress, err := publisher.(Resumable).Progress()
+	assert.NoError(t, err)
+	out.Reset()
+	resumed := NewJSONLPublisher(&out)
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.RecordError("https://docs.example.com/gone", ErrTypeNotFound, nil, Meta{Seed: "https://docs.example.com/"}))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"seed":"https://docs.example.com/"`)
+		stats := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &stats))
+		assert.Equal(t, map[string]any{
+			"https://example.com/":      map[string]any{"pages": 1.0, "errors": 0.0},
+			"https://docs.example.com/": map[string]any{"pages": 1.0, "errors": 1.0},
+		}, stats["seeds"])
+	}
+}
+
+func TestJSONLPublisher_ResumedTruncatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.jsonl")
+	out := appendTo(t, path)
+	stopped := NewJSONLPublisher(out)
+	assert.NoError(t, stopped.Publish("https://example.com/", nil, Meta{StatusCode: 200}))
+	progress, err := stopped.(Resumable).Progress()
+	assert.NoError(t, err)
+	// published after the checkpoint was saved, so it's published again once resumed
+	assert.NoError(t, stopped.Publish("https://example.com/a", nil, Meta{StatusCode: 200, Depth: 1}))
+	assert.NoError(t, out.Close())
+
+	out = appendTo(t, path)
+	defer out.Close()
+	resumed := NewJSONLPublisher(out)
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.Publish("https://example.com/a", nil, Meta{StatusCode: 200, Depth: 1}))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+
+	written, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Contains(t, lines[0], `"url":"https://example.com/"`)
+		assert.Contains(t, lines[1], `"url":"https://example.com/a"`)
+		assert.Contains(t, lines[2], `"pages":2`)
+	}
+}
@@ -0,0 +1,87 @@
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// multiPublisher sends every event to all of its publishers, in order.
+// it's as safe for concurrent use as its publishers are.
+type multiPublisher struct {
+	publishers []Publisher
+}
+
+// Multi returns a publisher sending every event to all the publishers, e.g. printing the progress while writing JSON Lines to a file.
+// every publisher gets the event even when one of the previous ones failed, their errors are joined.
+// it carries the progress of the Resumable ones over to resumed crawls.
+func Multi(publishers ...Publisher) Publisher {
+	return &multiPublisher{publishers: publishers}
+}
+
+func (m *multiPublisher) Publish(title string, lines []string, meta Meta) error {
+	return m.each(func(p Publisher) error { return p.Publish(title, lines, meta) })
+}
+
+func (m *multiPublisher) PublishStats(summary Summary) error {
+	return m.each(func(p Publisher) error { return p.PublishStats(summary) })
+}
+
+func (m *multiPublisher) RecordError(url string, failedFor ErrType, err error, meta Meta) error {
+	return m.each(func(p Publisher) error { return p.RecordError(url, failedFor, err, meta) })
+}
+
+func (m *multiPublisher) PublishRedirects(chain []Redirect) error {
+	return m.each(func(p Publisher) error { return p.PublishRedirects(chain) })
+}
+
+func (m *multiPublisher) each(fn func(p Publisher) error) error {
+	var errs []error
+	for _, p := range m.publishers {
+		if err := fn(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Progress saves the progress of the publishers by their position, null for the ones which aren't Resumable.
+func (m *multiPublisher) Progress() ([]byte, error) {
+	progress := make([]json.RawMessage, len(m.publishers))
+	for i, p := range m.publishers {
+		resumable, ok := p.(Resumable)
+		if !ok {
+			continue
+		}
+		saved, err := resumable.Progress()
+		if err != nil {
+			return nil, err
+		}
+		progress[i] = saved
+	}
+	return json.Marshal(progress)
+}
+
+func (m *multiPublisher) Restore(progress []byte) error {
+	var saved []json.RawMessage
+	if err := json.Unmarshal(progress, &saved); err != nil {
+		return err
+	}
+	if len(saved) != len(m.publishers) {
+		return fmt.Errorf("progress is for %d publishers, not %d", len(saved), len(m.publishers))
+	}
+	var errs []error
+	for i, p := range m.publishers {
+		resumable, ok := p.(Resumable)
+		if !ok || len(saved[i]) == 0 || string(saved[i]) == "null" {
+			continue
+		}
+		if err := resumable.Restore(saved[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var _ Publisher = (*multiPublisher)(nil)
+var _ Resumable = (*multiPublisher)(nil)
@@ -0,0 +1,56 @@
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingPublisher fails every event with err.
+type failingPublisher struct {
+	err error
+}
+
+func (f failingPublisher) Publish(string, []string, Meta) error           { return f.err }
+func (f failingPublisher) PublishStats(Summary) error                     { return f.err }
+func (f failingPublisher) RecordError(string, ErrType, error, Meta) error { return f.err }
+func (f failingPublisher) PublishRedirects([]Redirect) error              { return f.err }
+
+func TestMulti(t *testing.T) {
+	first, second := NewTestPublisher(), NewTestPublisher()
+	errFirst, errSecond := errors.New("first sink is down"), errors.New("second sink is down")
+	multi := Multi(first, failingPublisher{err: errFirst}, second, failingPublisher{err: errSecond})
+
+	err := multi.Publish("https://example.com/", []string{"https://example.com/a"}, Meta{StatusCode: 200})
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errSecond)
+	assert.Error(t, multi.RecordError("https://example.com/a", ErrTypeNotFound, errors.New("failed with status 404"), Meta{Depth: 1}))
+	assert.Error(t, multi.PublishRedirects([]Redirect{{URL: "https://example.com/old", StatusCode: 301}, {URL: "https://example.com/"}}))
+	assert.Error(t, multi.PublishStats(Summary{StopReason: "max pages of 1"}))
+
+	for _, p := range []*TestPublisher{first, second} {
+		assert.Equal(t, []string{"https://example.com/", "https://example.com/a"}, p.Published)
+		assert.Len(t, p.Meta, 2)
+		assert.Len(t, p.Redirects, 1)
+		assert.Equal(t, &Summary{StopReason: "max pages of 1"}, p.Summary)
+	}
+	assert.NoError(t, Multi(first, second).Publish("https://example.com/b", nil, Meta{}))
+}
+
+func TestMulti_Resumable(t *testing.T) {
+	var before bytes.Buffer
+	crawled := Multi(NewTestPublisher(), NewJSONLPublisher(&before))
+	assert.NoError(t, crawled.Publish("https://example.com/", []string{"https://example.com/a"}, Meta{}))
+	progress, err := crawled.(Resumable).Progress()
+	assert.NoError(t, err)
+
+	var after bytes.Buffer
+	resumed := Multi(NewTestPublisher(), NewJSONLPublisher(&after))
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+	assert.Contains(t, after.String(), `"pages":1,"links":1`)
+
+	assert.ErrorContains(t, Multi(NewTestPublisher()).(Resumable).Restore(progress), "is for 2 publishers, not 1")
+}
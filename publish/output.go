@@ -0,0 +1,56 @@
+package publish
+
+import (
+	"io"
+	"os"
+)
+
+// streamOutput is what a streamed publisher writes to, it keeps the length of the output so checkpoints can save it.
+// when a crawl is resumed, what the stopped one wrote after its last checkpoint is cut from the file,
+// as it's published again by the resumed one.
+type streamOutput struct {
+	w io.Writer
+	// length is the size of the file when w is one, the amount written to w otherwise
+	length int64
+}
+
+func newStreamOutput(w io.Writer) *streamOutput {
+	out := &streamOutput{w: w}
+	if file, ok := regularFile(w); ok {
+		if info, err := file.Stat(); err == nil {
+			out.length = info.Size()
+		}
+	}
+	return out
+}
+
+func (o *streamOutput) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.length += int64(n)
+	return n, err
+}
+
+// truncate cuts the file back to the length saved in a checkpoint, nil for the ones saved without it.
+// the output is left alone when it isn't a file, or when it's shorter than that
+// e.g. a new file rather than the one the stopped crawl wrote to.
+func (o *streamOutput) truncate(length *int64) error {
+	file, ok := regularFile(o.w)
+	if length == nil || !ok || o.length <= *length {
+		return nil
+	}
+	if err := file.Truncate(*length); err != nil {
+		return err
+	}
+	o.length = *length
+	return nil
+}
+
+// regularFile returns w when it's a file, rather than a terminal or a pipe e.g. stdout.
+func regularFile(w io.Writer) (*os.File, bool) {
+	file, ok := w.(*os.File)
+	if !ok {
+		return nil, false
+	}
+	info, err := file.Stat()
+	return file, err == nil && info.Mode().IsRegular()
+}
@@ -1,78 +1,318 @@
 package publish
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Publisher interface {
-	Publish(title string, lines []string) error
-	PublishStats() error
-	RecordError(url string, failedFor ErrType, err error) error
+	Publish(title string, lines []string, meta Meta) error
+	// PublishStats is called once the crawl is over, summary tells why it ended
+	PublishStats(summary Summary) error
+	RecordError(url string, failedFor ErrType, err error, meta Meta) error
+	// PublishRedirects is called with the whole chain whenever a url redirected,
+	// the last element being where it ended up.
+	PublishRedirects(chain []Redirect) error
 }
 
+// Resumable is a Publisher which can carry its progress over to a crawl resumed from a checkpoint.
+type Resumable interface {
+	// Progress returns what has to be saved along with the checkpoint
+	Progress() ([]byte, error)
+	// Restore brings back the progress of a previous Progress
+	Restore(progress []byte) error
+}
+
+// Meta is how a page was found during the crawl and how fetching it went.
+type Meta struct {
+	// Seed is the seed the page was reached from
+	Seed string
+	// Depth is the amount of links followed from the seed to get to the page, the seed being 0
+	Depth int
+	// Parent is the page the url was found on, empty for the seed
+	Parent string
+	// AnchorText is the text of the link on the parent page
+	AnchorText string
+	// StatusCode is the status of the page after following redirects, 0 when no response was received
+	StatusCode  int
+	ContentType string
+	// Duration is how long fetching the page took
+	Duration time.Duration
+	// Links are the outgoing links of a published page, in the same order as its published lines
+	Links []Link
+	// LastModified is when a published page was last modified according to the server, zero when unknown
+	LastModified time.Time
+	// Canonical is the normalized absolute canonical url of a published page, empty when it has none
+	Canonical string
+	// NoIndex is whether a published page asks not to be indexed
+	NoIndex bool
+	// Anchors are the element ids and `<a name>` of a published page, which `#fragment` links point to
+	Anchors []string
+}
+
+// Link is an outgoing link of a page.
+type Link struct {
+	URL        string
+	AnchorText string
+	// Rel is the rel attribute of the link e.g. "nofollow noopener"
+	Rel string
+	// Fragment is the decoded `#fragment` the link had, URL being without it
+	Fragment string
+	// Internal is whether the link stays within the crawled site
+	Internal bool
+}
+
+// FoundOn describes where the url was found, for error reports.
+func (m Meta) FoundOn() string {
+	if m.Parent == "" {
+		return "seed url"
+	}
+	if m.AnchorText == "" {
+		return "found on " + m.Parent
+	}
+	return fmt.Sprintf("found on %s as %q", m.Parent, m.AnchorText)
+}
+
+// Summary is how the crawl ended.
+type Summary struct {
+	// StopReason is the budget which ended the crawl early e.g. "max pages of 100",
+	// empty when the crawl ran out of pages to crawl
+	StopReason string
+	// CappedHosts are the hosts which had pages left out for hitting the pages per host budget
+	CappedHosts []string
+	// VisitedSets are the stats of the sets the crawl deduplicated urls with
+	VisitedSets []VisitedSetStats
+	// Async is how the buffer fared when publishing through an AsyncPublisher, nil otherwise
+	Async *AsyncStats
+}
+
+// VisitedSetStats is how much a set deduplicating urls holds.
+type VisitedSetStats struct {
+	// Name is what the set is used for e.g. "visited"
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+	// MemoryBytes is an estimate of the memory used by the set
+	MemoryBytes int64 `json:"memory_bytes"`
+	// FalsePositiveRate is the estimated probability for a new url to be mistaken as already seen
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// SeedStats is what was crawled from one of the seeds, a page reached from several seeds counting for the first.
+type SeedStats struct {
+	Pages  int `json:"pages"`
+	Errors int `json:"errors"`
+}
+
+// seedCounts are the stats of every seed, pages without a seed aren't counted.
+type seedCounts map[string]SeedStats
+
+func (s seedCounts) count(seed string, pages, errors int) {
+	if seed == "" {
+		return
+	}
+	stats := s[seed]
+	stats.Pages += pages
+	stats.Errors += errors
+	s[seed] = stats
+}
+
+// Redirect is a single hop of a redirect chain.
+type Redirect struct {
+	URL string `json:"url"`
+	// StatusCode is 0 for where a chain leads when it's out of the crawl, it's not requested then
+	StatusCode int `json:"status"`
+}
+
+// consoleLinkPublisher prints the links of every page as they're crawled, followed by the stats.
+// it's safe for concurrent use, what's printed for a page is written at once so it doesn't interleave with others.
 type consoleLinkPublisher struct {
-	createdAt    time.Time
-	totalPages   int
-	totalLinks   int
-	totalErrors  int
-	erroredPages map[ErrType][]string
+	mu             sync.Mutex
+	out            *streamOutput
+	createdAt      time.Time
+	totalPages     int
+	totalLinks     int
+	totalErrors    int
+	totalRedirects int
+	erroredPages   map[ErrType][]string
+	seeds          seedCounts
 }
 
-func (c *consoleLinkPublisher) Publish(title string, lines []string) error {
-	c.totalPages++
-	c.totalLinks += len(lines)
-	fmt.Println("Links found on: ", title)
+func (c *consoleLinkPublisher) Publish(title string, lines []string, meta Meta) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, "Links found on: ", title)
 	for _, s := range lines {
-		fmt.Println(" - " + s)
+		fmt.Fprintln(&b, " - "+s)
 	}
-	return nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totalPages++
+	c.totalLinks += len(lines)
+	c.seeds.count(meta.Seed, 1, 0)
+	_, err := io.WriteString(c.out, b.String())
+	return err
 }
 
-func (c *consoleLinkPublisher) PublishStats() error {
+func (c *consoleLinkPublisher) PublishStats(summary Summary) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	totalTimeSpent := time.Since(c.createdAt).Seconds()
-	totalErrors := 0
-	for _, s := range c.erroredPages {
-		totalErrors += len(s)
-	}
-	fmt.Println("---------------------Crawler stats ------------------")
-	fmt.Println("-")
-	fmt.Printf("Total time spent: %v seconds\n", totalTimeSpent)
-	fmt.Println("Total pages crawled: ", c.totalPages)
-	fmt.Println("Total links found: ", c.totalLinks)
-	fmt.Println("Total Errors: ", len(c.erroredPages))
+	var b strings.Builder
+	fmt.Fprintln(&b, "---------------------Crawler stats ------------------")
+	fmt.Fprintln(&b, "-")
+	fmt.Fprintf(&b, "Total time spent: %v seconds\n", totalTimeSpent)
+	fmt.Fprintln(&b, "Total pages crawled: ", c.totalPages)
+	fmt.Fprintln(&b, "Total links found: ", c.totalLinks)
+	fmt.Fprintln(&b, "Total redirects: ", c.totalRedirects)
+	fmt.Fprintln(&b, "Total Errors: ", c.totalErrors)
+	if len(c.seeds) > 1 {
+		seeds := make([]string, 0, len(c.seeds))
+		for seed := range c.seeds {
+			seeds = append(seeds, seed)
+		}
+		slices.Sort(seeds)
+		for _, seed := range seeds {
+			fmt.Fprintf(&b, "Seed %s: %d pages, %d errors\n", seed, c.seeds[seed].Pages, c.seeds[seed].Errors)
+		}
+	}
+	if summary.StopReason != "" {
+		fmt.Fprintln(&b, "Stopped early, budget hit: ", summary.StopReason)
+	}
+	for _, host := range summary.CappedHosts {
+		fmt.Fprintln(&b, "Pages per host budget hit for: ", host)
+	}
+	for _, set := range summary.VisitedSets {
+		fmt.Fprintf(&b, "Urls %s (%s set): %d, ~%d KiB, false positive rate %.2g\n",
+			set.Name, set.Kind, set.Count, set.MemoryBytes/1024, set.FalsePositiveRate)
+	}
+	if summary.Async != nil {
+		fmt.Fprintf(&b, "Publish buffer: %d events published, %d dropped, %d failed, at most %d of %d queued\n",
+			summary.Async.Published, summary.Async.Dropped, summary.Async.Failed, summary.Async.MaxQueued, summary.Async.BufferSize)
+	}
 	if c.totalErrors > 0 {
-		fmt.Println("---------------------Error stats --------------------")
-		for k, s := range c.erroredPages {
-			fmt.Println("[Error]: ", k)
+		fmt.Fprintln(&b, "---------------------Error stats --------------------")
+		types := make([]ErrType, 0, len(c.erroredPages))
+		for k := range c.erroredPages {
+			types = append(types, k)
+		}
+		slices.Sort(types)
+		for _, k := range types {
+			s := c.erroredPages[k]
+			fmt.Fprintf(&b, "[Error]:  %s (%d)\n", k, len(s))
 			for _, s := range s {
-				fmt.Println("-- ", s)
+				fmt.Fprintln(&b, "-- ", s)
 			}
 		}
-		fmt.Print("- ")
+		fmt.Fprint(&b, "- ")
 	}
-	fmt.Println("-----------------------------------------------------")
-	return nil
+	fmt.Fprintln(&b, "-----------------------------------------------------")
+	_, err := io.WriteString(c.out, b.String())
+	return err
 }
 
-func (c *consoleLinkPublisher) RecordError(url string, cause ErrType, error error) error {
+func (c *consoleLinkPublisher) RecordError(url string, cause ErrType, error error, meta Meta) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.totalErrors++
+	c.seeds.count(meta.Seed, 0, 1)
 	pages, exists := c.erroredPages[cause]
 	if !exists {
 		pages = make([]string, 0)
 	}
-	pages = append(pages, url)
+	pages = append(pages, fmt.Sprintf("%s (%s)", url, meta.FoundOn()))
 	c.erroredPages[cause] = pages
 	return nil
 }
 
+func (c *consoleLinkPublisher) PublishRedirects(chain []Redirect) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintln(&b, "Redirects for: ", chain[0].URL)
+	for _, hop := range chain {
+		fmt.Fprintf(&b, " - [%d] %s\n", hop.StatusCode, hop.URL)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totalRedirects++
+	_, err := io.WriteString(c.out, b.String())
+	return err
+}
+
+// consoleProgress is the part of consoleLinkPublisher which is saved in checkpoints.
+type consoleProgress struct {
+	TotalPages     int                  `json:"total_pages"`
+	TotalLinks     int                  `json:"total_links"`
+	TotalErrors    int                  `json:"total_errors"`
+	TotalRedirects int                  `json:"total_redirects"`
+	ErroredPages   map[ErrType][]string `json:"errored_pages"`
+	Seeds          seedCounts           `json:"seeds,omitempty"`
+	// Length is the length of the output, cut back to it when resuming
+	Length *int64 `json:"length,omitempty"`
+}
+
+func (c *consoleLinkPublisher) Progress() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(consoleProgress{
+		TotalPages:     c.totalPages,
+		TotalLinks:     c.totalLinks,
+		TotalErrors:    c.totalErrors,
+		TotalRedirects: c.totalRedirects,
+		ErroredPages:   c.erroredPages,
+		Seeds:          c.seeds,
+		Length:         &c.out.length,
+	})
+}
+
+func (c *consoleLinkPublisher) Restore(progress []byte) error {
+	restored := consoleProgress{}
+	if err := json.Unmarshal(progress, &restored); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.out.truncate(restored.Length); err != nil {
+		return fmt.Errorf("failed to truncate the output: %w", err)
+	}
+	c.totalPages = restored.TotalPages
+	c.totalLinks = restored.TotalLinks
+	c.totalErrors = restored.TotalErrors
+	c.totalRedirects = restored.TotalRedirects
+	c.erroredPages = restored.ErroredPages
+	if c.erroredPages == nil {
+		c.erroredPages = make(map[ErrType][]string)
+	}
+	c.seeds = restored.Seeds
+	if c.seeds == nil {
+		c.seeds = make(seedCounts)
+	}
+	return nil
+}
+
 var _ Publisher = (*consoleLinkPublisher)(nil)
+var _ Resumable = (*consoleLinkPublisher)(nil)
 
+// NewConsolePublisher prints the crawl to stdout in a human readable way.
 func NewConsolePublisher() Publisher {
+	return NewConsolePublisherTo(os.Stdout)
+}
+
+// NewConsolePublisherTo is NewConsolePublisher printing to w.
+func NewConsolePublisherTo(w io.Writer) Publisher {
 	return &consoleLinkPublisher{
+		out:          newStreamOutput(w),
 		createdAt:    time.Now(),
 		totalPages:   0,
 		totalLinks:   0,
 		erroredPages: make(map[ErrType][]string, 0),
+		seeds:        make(seedCounts),
 	}
 }
@@ -0,0 +1,57 @@
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsolePublisher_ConcurrentUse(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewConsolePublisherTo(&out)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				page := fmt.Sprintf("https://example.com/%d/%d", worker, i)
+				_ = publisher.Publish(page, []string{page + "/a", page + "/b"}, Meta{})
+				_ = publisher.RecordError(page+"/gone", ErrTypeNotFound, errors.New("failed with status 404"), Meta{Parent: page})
+			}
+		}()
+	}
+	wg.Wait()
+	lines := strings.Split(out.String(), "\n")
+	for i, line := range lines {
+		// the links of a page follow it, never the ones of another page
+		if page, found := strings.CutPrefix(line, "Links found on:  "); found {
+			assert.Equal(t, " - "+page+"/a", lines[i+1])
+			assert.Equal(t, " - "+page+"/b", lines[i+2])
+		}
+	}
+
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+	assert.Contains(t, out.String(), "Total pages crawled:  400\n")
+	assert.Contains(t, out.String(), "Total links found:  800\n")
+	assert.Contains(t, out.String(), "Total Errors:  400\n")
+}
+
+func TestConsolePublisher_Seeds(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewConsolePublisherTo(&out)
+	assert.NoError(t, publisher.Publish("https://example.com/", nil, Meta{Seed: "https://example.com/"}))
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+	// a single seed is what the totals are about
+	assert.NotContains(t, out.String(), "Seed ")
+
+	assert.NoError(t, publisher.RecordError("https://docs.example.com/", ErrTypeTimeout, nil, Meta{Seed: "https://docs.example.com/"}))
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+	assert.Contains(t, out.String(), "Seed https://docs.example.com/: 0 pages, 1 errors\nSeed https://example.com/: 1 pages, 0 errors\n")
+}
@@ -0,0 +1,239 @@
+package publish
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SitemapMaxURLs is the most urls a sitemap can have according to the protocol
+	SitemapMaxURLs = 50000
+	// SitemapMaxBytes is the biggest a sitemap can be uncompressed according to the protocol
+	SitemapMaxBytes = 50 * 1024 * 1024
+
+	sitemapXmlns  = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapName   = "sitemap"
+	sitemapFooter = "</urlset>\n"
+)
+
+// SitemapOptions configures where and how the sitemaps are written.
+type SitemapOptions struct {
+	// Dir is where the files are written
+	Dir string
+	// BaseURL is where the files are served from, the sitemap index points to the sitemaps under it
+	BaseURL string
+	// Gzip compresses the files, which get a ".gz" extension
+	Gzip bool
+	// MaxURLs is the most urls per sitemap, SitemapMaxURLs when 0
+	MaxURLs int
+}
+
+// sitemapPublisher collects the pages which belong in a sitemap, writing it once the crawl is over.
+// a page belongs in it when it was crawled with a 200 status, is HTML, isn't noindex and is its own canonical.
+type sitemapPublisher struct {
+	mu      sync.Mutex
+	options SitemapOptions
+	// pages are the urls of the sitemap along with when they were last modified
+	pages map[string]time.Time
+}
+
+// NewSitemapPublisher writes sitemap.xml to the directory of the options once the crawl is over.
+// when there are more urls than fit in a sitemap, they're split over sitemap-1.xml, sitemap-2.xml...
+// and sitemap.xml is the sitemap index pointing to them.
+func NewSitemapPublisher(options SitemapOptions) Publisher {
+	if options.MaxURLs <= 0 || options.MaxURLs > SitemapMaxURLs {
+		options.MaxURLs = SitemapMaxURLs
+	}
+	return &sitemapPublisher{options: options, pages: make(map[string]time.Time)}
+}
+
+func (s *sitemapPublisher) Publish(title string, _ []string, meta Meta) error {
+	if !inSitemap(title, meta) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[title] = meta.LastModified
+	return nil
+}
+
+func (s *sitemapPublisher) RecordError(string, ErrType, error, Meta) error {
+	return nil
+}
+
+func (s *sitemapPublisher) PublishRedirects([]Redirect) error {
+	return nil
+}
+
+func (s *sitemapPublisher) PublishStats(_ Summary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	urls := make([]string, 0, len(s.pages))
+	for url := range s.pages {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	sitemaps := s.split(urls)
+	if len(sitemaps) == 1 {
+		return s.writeFile(s.fileName(""), sitemaps[0].content())
+	}
+	if s.options.BaseURL == "" {
+		return errors.New("the sitemap index needs the base url the sitemaps are served from")
+	}
+	index := &strings.Builder{}
+	index.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	index.WriteString(`<sitemapindex xmlns="` + sitemapXmlns + `">` + "\n")
+	for i, sitemap := range sitemaps {
+		name := s.fileName(fmt.Sprintf("-%d", i+1))
+		if err := s.writeFile(name, sitemap.content()); err != nil {
+			return err
+		}
+		index.WriteString("  <sitemap><loc>" + xmlEscape(strings.TrimSuffix(s.options.BaseURL, "/")+"/"+name) + "</loc>")
+		if !sitemap.lastModified.IsZero() {
+			index.WriteString("<lastmod>" + sitemapTime(sitemap.lastModified) + "</lastmod>")
+		}
+		index.WriteString("</sitemap>\n")
+	}
+	index.WriteString("</sitemapindex>\n")
+	return s.writeFile(s.fileName(""), index.String())
+}
+
+// sitemap is the content of a single sitemap file.
+type sitemap struct {
+	entries *strings.Builder
+	count   int
+	// lastModified is the most recent of its pages, for the sitemap index
+	lastModified time.Time
+}
+
+func newSitemap() *sitemap {
+	entries := &strings.Builder{}
+	entries.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	entries.WriteString(`<urlset xmlns="` + sitemapXmlns + `">` + "\n")
+	return &sitemap{entries: entries}
+}
+
+func (m *sitemap) content() string {
+	return m.entries.String() + sitemapFooter
+}
+
+// sitemapProgress is the part of sitemapPublisher which is saved in checkpoints,
+// so the sitemap of a resumed crawl has the pages crawled before it was stopped.
+type sitemapProgress struct {
+	Pages map[string]time.Time `json:"pages"`
+}
+
+func (s *sitemapPublisher) Progress() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(sitemapProgress{Pages: s.pages})
+}
+
+func (s *sitemapPublisher) Restore(progress []byte) error {
+	restored := sitemapProgress{}
+	if err := json.Unmarshal(progress, &restored); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = restored.Pages
+	if s.pages == nil {
+		s.pages = make(map[string]time.Time)
+	}
+	return nil
+}
+
+// split spreads the urls over as many sitemaps as needed to stay within the limits, there's always at least one.
+// s.mu must be held.
+func (s *sitemapPublisher) split(urls []string) []*sitemap {
+	current := newSitemap()
+	sitemaps := []*sitemap{current}
+	for _, url := range urls {
+		lastModified := s.pages[url]
+		entry := "  <url><loc>" + xmlEscape(url) + "</loc>"
+		if !lastModified.IsZero() {
+			entry += "<lastmod>" + sitemapTime(lastModified) + "</lastmod>"
+		}
+		entry += "</url>\n"
+		full := current.count == s.options.MaxURLs ||
+			current.entries.Len()+len(entry)+len(sitemapFooter) > SitemapMaxBytes
+		if full && current.count > 0 {
+			current = newSitemap()
+			sitemaps = append(sitemaps, current)
+		}
+		current.entries.WriteString(entry)
+		current.count++
+		if lastModified.After(current.lastModified) {
+			current.lastModified = lastModified
+		}
+	}
+	return sitemaps
+}
+
+// fileName is the name of a sitemap file, suffix telling the split ones apart.
+func (s *sitemapPublisher) fileName(suffix string) string {
+	name := sitemapName + suffix + ".xml"
+	if s.options.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+func (s *sitemapPublisher) writeFile(name string, content string) error {
+	file, err := os.Create(filepath.Join(s.options.Dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create sitemap: %w", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	var w io.Writer = out
+	var compressed *gzip.Writer
+	if s.options.Gzip {
+		compressed = gzip.NewWriter(out)
+		w = compressed
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		return fmt.Errorf("failed to write sitemap: %w", err)
+	}
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			return fmt.Errorf("failed to write sitemap: %w", err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write sitemap: %w", err)
+	}
+	return file.Close()
+}
+
+// inSitemap tells whether the published page belongs in a sitemap.
+func inSitemap(url string, meta Meta) bool {
+	if meta.StatusCode != 200 || meta.NoIndex {
+		return false
+	}
+	if meta.Canonical != "" && meta.Canonical != url {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(meta.ContentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// sitemapTime formats t in the W3C Datetime format of lastmod.
+func sitemapTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+var _ Publisher = (*sitemapPublisher)(nil)
+var _ Resumable = (*sitemapPublisher)(nil)
@@ -0,0 +1,123 @@
+package publish
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// publishSitemapPages publishes pages a, b and c which belong in the sitemap along with ones which don't.
+func publishSitemapPages(t *testing.T, publisher Publisher) {
+	t.Helper()
+	html := Meta{StatusCode: 200, ContentType: "text/html; charset=utf-8"}
+	modified := html
+	modified.LastModified = time.Date(2024, 5, 1, 10, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	canonical := html
+	canonical.Canonical = "https://example.com/b"
+	duplicate := html
+	duplicate.Canonical = "https://example.com/a"
+	noIndex := html
+	noIndex.NoIndex = true
+
+	assert.NoError(t, publisher.Publish("https://example.com/c?x=1&y=2", nil, html))
+	assert.NoError(t, publisher.Publish("https://example.com/a", nil, modified))
+	assert.NoError(t, publisher.Publish("https://example.com/b", nil, canonical))
+	assert.NoError(t, publisher.Publish("https://example.com/a?utm=1", nil, duplicate))
+	assert.NoError(t, publisher.Publish("https://example.com/private", nil, noIndex))
+	assert.NoError(t, publisher.Publish("https://example.com/feed", nil, Meta{StatusCode: 200, ContentType: "application/rss+xml"}))
+	assert.NoError(t, publisher.RecordError("https://example.com/gone", ErrTypeNotFound, errors.New("failed with status 404"), Meta{StatusCode: 404}))
+	assert.NoError(t, publisher.PublishStats(Summary{}))
+}
+
+func TestSitemapPublisher(t *testing.T) {
+	dir := t.TempDir()
+	publishSitemapPages(t, NewSitemapPublisher(SitemapOptions{Dir: dir}))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		`  <url><loc>https://example.com/a</loc><lastmod>2024-05-01T08:30:00Z</lastmod></url>`+"\n"+
+		`  <url><loc>https://example.com/b</loc></url>`+"\n"+
+		`  <url><loc>https://example.com/c?x=1&amp;y=2</loc></url>`+"\n"+
+		`</urlset>`+"\n", readSitemap(t, filepath.Join(dir, "sitemap.xml"), false))
+	assert.Equal(t, []string{"sitemap.xml"}, fileNames(t, dir))
+}
+
+func TestSitemapPublisher_Resumed(t *testing.T) {
+	dir := t.TempDir()
+	publisher := NewSitemapPublisher(SitemapOptions{Dir: dir})
+	assert.NoError(t, publisher.Publish("https://example.com/a", nil, Meta{StatusCode: 200, ContentType: "text/html"}))
+	progress, err := publisher.(Resumable).Progress()
+	assert.NoError(t, err)
+
+	// the pages crawled before the crawl was stopped are in the sitemap of the resumed one
+	resumed := NewSitemapPublisher(SitemapOptions{Dir: dir})
+	assert.NoError(t, resumed.(Resumable).Restore(progress))
+	assert.NoError(t, resumed.Publish("https://example.com/b", nil, Meta{StatusCode: 200, ContentType: "text/html"}))
+	assert.NoError(t, resumed.PublishStats(Summary{}))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		`  <url><loc>https://example.com/a</loc></url>`+"\n"+
+		`  <url><loc>https://example.com/b</loc></url>`+"\n"+
+		`</urlset>`+"\n", readSitemap(t, filepath.Join(dir, "sitemap.xml"), false))
+}
+
+func TestSitemapPublisher_SplitIntoIndex(t *testing.T) {
+	dir := t.TempDir()
+	publishSitemapPages(t, NewSitemapPublisher(SitemapOptions{Dir: dir, BaseURL: "https://example.com/", Gzip: true, MaxURLs: 2}))
+
+	assert.Equal(t, []string{"sitemap-1.xml.gz", "sitemap-2.xml.gz", "sitemap.xml.gz"}, fileNames(t, dir))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		`  <sitemap><loc>https://example.com/sitemap-1.xml.gz</loc><lastmod>2024-05-01T08:30:00Z</lastmod></sitemap>`+"\n"+
+		`  <sitemap><loc>https://example.com/sitemap-2.xml.gz</loc></sitemap>`+"\n"+
+		`</sitemapindex>`+"\n", readSitemap(t, filepath.Join(dir, "sitemap.xml.gz"), true))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+"\n"+
+		`  <url><loc>https://example.com/c?x=1&amp;y=2</loc></url>`+"\n"+
+		`</urlset>`+"\n", readSitemap(t, filepath.Join(dir, "sitemap-2.xml.gz"), true))
+}
+
+func TestSitemapPublisher_IndexWithoutBaseURL(t *testing.T) {
+	publisher := NewSitemapPublisher(SitemapOptions{Dir: t.TempDir(), MaxURLs: 1})
+	html := Meta{StatusCode: 200, ContentType: "text/html"}
+	assert.NoError(t, publisher.Publish("https://example.com/a", nil, html))
+	assert.NoError(t, publisher.Publish("https://example.com/b", nil, html))
+	assert.ErrorContains(t, publisher.PublishStats(Summary{}), "base url")
+}
+
+func readSitemap(t *testing.T, path string, compressed bool) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if compressed {
+		r, err = gzip.NewReader(file)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+	}
+	content, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func fileNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
@@ -1,16 +1,31 @@
 package publish
 
+import "sync"
+
+// TestPublisher records everything in memory, it's safe for concurrent usage
+// since the parallel crawler publishes from every worker.
 type TestPublisher struct {
+	mu        sync.Mutex
 	Published []string
+	Redirects [][]Redirect
+	// Meta of every published page and recorded error, by url
+	Meta map[string]Meta
+	// Summary is the one given to PublishStats
+	Summary *Summary
 }
 
 func NewTestPublisher() *TestPublisher {
 	return &TestPublisher{
 		Published: make([]string, 0),
+		Redirects: make([][]Redirect, 0),
+		Meta:      make(map[string]Meta),
 	}
 }
 
-func (p *TestPublisher) Publish(string string, strings []string) error {
+func (p *TestPublisher) Publish(string string, strings []string, meta Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Meta[string] = meta
 	p.Published = append(p.Published, string)
 	for _, str := range strings {
 		p.Published = append(p.Published, str)
@@ -18,10 +33,25 @@ func (p *TestPublisher) Publish(string string, strings []string) error {
 	return nil
 }
 
-func (c *TestPublisher) RecordError(_ string, _ ErrType) error {
+func (c *TestPublisher) RecordError(url string, _ ErrType, _ error, meta Meta) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Meta[url] = meta
 	return nil
 }
 
-func (p *TestPublisher) PublishStats() error {
+func (p *TestPublisher) PublishStats(summary Summary) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Summary = &summary
 	return nil
 }
+
+func (p *TestPublisher) PublishRedirects(chain []Redirect) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Redirects = append(p.Redirects, chain)
+	return nil
+}
+
+var _ Publisher = (*TestPublisher)(nil)